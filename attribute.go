@@ -0,0 +1,365 @@
+package sdp_transform
+
+import (
+    "fmt"
+    "reflect"
+    "regexp"
+    "sort"
+    "strings"
+)
+
+// AttributeCodec
+// A Go type for an a= attribute the grammar does not know, such as an in-house
+// a=x-... line. Register it with RegisterAttribute or Grammar.RegisterAttribute;
+// parsed lines are then decoded into new values of the codec's type and kept in
+// the Extensions of the session or media description, under the codec's name.
+type AttributeCodec interface {
+    // Name is the attribute name, e.g. "x-bitrate" for a=x-bitrate:...
+    Name() string
+    // Unmarshal fills the codec from the value after the colon, "" when the
+    // line has none.
+    Unmarshal(value string) error
+    // Marshal returns the value to write after the colon; "" writes the
+    // attribute without one.
+    Marshal() string
+}
+
+var attributeName = regexp.MustCompile(`^[A-Za-z0-9][\w.\-]*$`)
+
+// RegisterAttribute registers the codec with the default grammar, see
+// Grammar.RegisterAttribute.
+func RegisterAttribute(codec AttributeCodec) error {
+    return defaultGrammar.RegisterAttribute(codec)
+}
+
+// RegisterAttribute adds a rule for a=<name> and a=<name>:<value> lines, where
+// name is the codec's Name. The codec must be a pointer; every line is decoded
+// into a new value of the type it points to. Lines the codec fails to
+// unmarshal are kept in Invalid. Names the grammar already has a rule for,
+// such as "mid" or "rtpmap", are rejected with ErrInvalidRule.
+func (g *Grammar) RegisterAttribute(codec AttributeCodec) error {
+    t := reflect.TypeOf(codec)
+    if t == nil || t.Kind() != reflect.Ptr {
+        return fmt.Errorf("%w: attribute codec %T is not a pointer", ErrInvalidRule, codec)
+    }
+    name := codec.Name()
+    if !attributeName.MatchString(name) {
+        return fmt.Errorf("%w: attribute name %q", ErrInvalidRule, name)
+    }
+    return g.register("a", &Rule{
+        Push:  name,
+        Reg:   regexp.MustCompile(`^` + regexp.QuoteMeta(name) + `(?::(.*))?$`),
+        Names: []string{"value"},
+        Format: func(m map[string]string) string {
+            if _, ok := m["value"]; ok {
+                return name + ":%s"
+            }
+            return name
+        },
+        codec: t,
+    }, func(rules []*Rule) error {
+        // the codec rule goes after the existing ones and would never match
+        for _, rule := range rules {
+            if contains(ruleAttributeNames(rule.Reg), name) {
+                return fmt.Errorf("%w: attribute name %q is handled by rule %q", ErrInvalidRule, name, rule.key())
+            }
+        }
+        return nil
+    })
+}
+
+// ruleAttributeNames returns the attribute names an a= rule matches, read from
+// the literal text its regexp starts with: "rtpmap" for ^rtpmap:(\d*) ...,
+// "sendrecv" and the others for ^(sendrecv|recvonly|...). It returns nil for
+// regexps that do not start with a plain name, such as the catch-all.
+func ruleAttributeNames(reg *regexp.Regexp) []string {
+    src := reg.String()
+    if !strings.HasPrefix(src, "^") {
+        return nil
+    }
+    src = src[1:]
+    if strings.HasPrefix(src, "(") && !strings.HasPrefix(src, "(?") {
+        end := strings.Index(src, ")")
+        if end < 0 {
+            return nil
+        }
+        var names []string
+        for _, name := range strings.Split(src[1:end], "|") {
+            if attributeName.MatchString(name) {
+                names = append(names, name)
+            }
+        }
+        return names
+    }
+    name := &strings.Builder{}
+    for i := 0; i < len(src); i++ {
+        c := src[i]
+        switch {
+        case c == ':' || c == '(' || c == '$':
+            return []string{name.String()}
+        case c == '\\' && i+1 < len(src) && strings.IndexByte(`.-`, src[i+1]) >= 0:
+            i++
+            name.WriteByte(src[i])
+        case strings.IndexByte(`\.+*?)|[]{}^`, c) >= 0:
+            // a quantifier or class makes the name ambiguous
+            return nil
+        default:
+            name.WriteByte(c)
+        }
+    }
+    return []string{name.String()}
+}
+
+// decodeAttribute unmarshals the value of a line matched by a codec rule into
+// a new value of the codec's type.
+func decodeAttribute(rule *Rule, value string) (AttributeCodec, error) {
+    codec := reflect.New(rule.codec.Elem()).Interface().(AttributeCodec)
+    if err := codec.Unmarshal(value); err != nil {
+        return nil, err
+    }
+    return codec, nil
+}
+
+// Codecs returns the attributes decoded by the codec registered under name, in
+// the order of their lines.
+func (e Extensions) Codecs(name string) []AttributeCodec {
+    codecs, _ := e[name].([]AttributeCodec)
+    return codecs
+}
+
+// Codec returns the first attribute decoded by the codec registered under
+// name, or nil when there is none.
+func (e Extensions) Codec(name string) AttributeCodec {
+    if codecs := e.Codecs(name); len(codecs) != 0 {
+        return codecs[0]
+    }
+    return nil
+}
+
+// AddCodec appends an attribute to be written as a=<name>:<value>. The codec
+// must be registered with the grammar of the Writer.
+func (e *Extensions) AddCodec(codec AttributeCodec) {
+    if *e == nil {
+        *e = Extensions{}
+    }
+    name := codec.Name()
+    (*e)[name] = append(e.Codecs(name), codec)
+}
+
+// SetCodecs replaces the attributes registered under name, removing them
+// when codecs is empty.
+func (e *Extensions) SetCodecs(name string, codecs ...AttributeCodec) {
+    if len(codecs) == 0 {
+        delete(*e, name)
+        return
+    }
+    if *e == nil {
+        *e = Extensions{}
+    }
+    (*e)[name] = codecs
+}
+
+// The generic attribute access below works on the a= lines of a section: they
+// are written with the grammar the description was parsed with, or the default
+// grammar for descriptions built by hand, edited as text and parsed back into
+// the typed fields, so both views always agree.
+
+// GetAttribute returns the values of the a=<name> lines at session level, ""
+// for lines without a value. It returns nil when the attributes cannot be
+// written; use GetAttributeWithError to find out why.
+func (s *SessionDescription) GetAttribute(name string) []string {
+    values, _ := s.GetAttributeWithError(name)
+    return values
+}
+
+// GetAttributeWithError is GetAttribute reporting attributes that cannot be
+// written as a *WriteError.
+func (s *SessionDescription) GetAttributeWithError(name string) ([]string, error) {
+    return getAttribute(s, s.grammar, name)
+}
+
+// SetAttribute replaces the a=<name> lines at session level with one line
+// holding value.
+func (s *SessionDescription) SetAttribute(name, value string) error {
+    return editAttributes(s, s.grammar, &s.Extensions, name, setAttribute(value))
+}
+
+// AddAttribute appends an a=<name>:<value> line at session level, or a=<name>
+// when value is "".
+func (s *SessionDescription) AddAttribute(name, value string) error {
+    return editAttributes(s, s.grammar, &s.Extensions, name, addAttribute(value))
+}
+
+// RemoveAttribute removes the a=<name> lines at session level.
+func (s *SessionDescription) RemoveAttribute(name string) error {
+    return editAttributes(s, s.grammar, &s.Extensions, name, removeAttribute)
+}
+
+// GetAttribute returns the values of the a=<name> lines of the media
+// description, "" for lines without a value. It returns nil when the
+// attributes cannot be written; use GetAttributeWithError to find out why.
+func (m *Media) GetAttribute(name string) []string {
+    values, _ := m.GetAttributeWithError(name)
+    return values
+}
+
+// GetAttributeWithError is GetAttribute reporting attributes that cannot be
+// written as a *WriteError.
+func (m *Media) GetAttributeWithError(name string) ([]string, error) {
+    return getAttribute(m, m.grammar, name)
+}
+
+// SetAttribute replaces the a=<name> lines of the media description with one
+// line holding value.
+func (m *Media) SetAttribute(name, value string) error {
+    return editAttributes(m, m.grammar, &m.Extensions, name, setAttribute(value))
+}
+
+// AddAttribute appends an a=<name>:<value> line to the media description, or
+// a=<name> when value is "".
+func (m *Media) AddAttribute(name, value string) error {
+    return editAttributes(m, m.grammar, &m.Extensions, name, addAttribute(value))
+}
+
+// RemoveAttribute removes the a=<name> lines of the media description.
+func (m *Media) RemoveAttribute(name string) error {
+    return editAttributes(m, m.grammar, &m.Extensions, name, removeAttribute)
+}
+
+// attribute is an a= line split into name and value.
+type attribute struct {
+    name, value string
+    flag        bool
+}
+
+func (a attribute) String() string {
+    if a.flag {
+        return a.name
+    }
+    return a.name + ":" + a.value
+}
+
+func setAttribute(value string) func(attrs []attribute, name string) []attribute {
+    return func(attrs []attribute, name string) []attribute {
+        return addAttribute(value)(removeAttribute(attrs, name), name)
+    }
+}
+
+func addAttribute(value string) func(attrs []attribute, name string) []attribute {
+    return func(attrs []attribute, name string) []attribute {
+        return append(attrs, attribute{name: name, value: value, flag: value == ""})
+    }
+}
+
+func removeAttribute(attrs []attribute, name string) []attribute {
+    kept := attrs[:0]
+    for _, a := range attrs {
+        if a.name != name {
+            kept = append(kept, a)
+        }
+    }
+    return kept
+}
+
+// attributes writes the a= lines of v, a *SessionDescription or *Media, with
+// the grammar g. Values holding control characters are rejected as by Write.
+func attributes(v interface{}, g GrammarMap) ([]attribute, error) {
+    w := &sectionWriter{grammar: g, policy: SanitizeReject}
+    lines, err := w.sectionLines([]string{"a"}, reflect.ValueOf(v).Elem(), sharedFields(reflect.ValueOf(v).Elem()))
+    if err != nil {
+        return nil, err
+    }
+    attrs := make([]attribute, 0, len(lines))
+    for _, line := range lines {
+        if !strings.HasPrefix(line.text, "a=") {
+            continue
+        }
+        name, value, ok := strings.Cut(line.text[2:], ":")
+        attrs = append(attrs, attribute{name: name, value: value, flag: !ok})
+    }
+    return attrs, nil
+}
+
+// sharedFields returns the fields v, a SessionDescription or Media, shares
+// with the other level.
+func sharedFields(v reflect.Value) *SharedDescriptionFields {
+    return v.FieldByName("SharedDescriptionFields").Addr().Interface().(*SharedDescriptionFields)
+}
+
+func getAttribute(v interface{}, g GrammarMap, name string) ([]string, error) {
+    if g == nil {
+        g = currentGrammar()
+    }
+    attrs, err := attributes(v, g)
+    if err != nil {
+        return nil, err
+    }
+    var values []string
+    for _, a := range attrs {
+        if a.name == name {
+            values = append(values, a.value)
+        }
+    }
+    return values, nil
+}
+
+// editAttributes applies edit to the a= lines of v and parses the result back
+// into the fields and extensions the a= rules fill. Attributes that parse into
+// neither are rejected and v is left as it was.
+func editAttributes(v interface{}, g GrammarMap, ext *Extensions, name string, edit func(attrs []attribute, name string) []attribute) error {
+    if name == "" || strings.ContainsAny(name, ": ") || strings.IndexFunc(name, isControl) != -1 {
+        return &WriteError{Type: "a", Rule: name, Err: fmt.Errorf("%w: attribute name %q", ErrUnsupportedValue, name)}
+    }
+    if g == nil {
+        g = currentGrammar()
+    }
+    attrs, err := attributes(v, g)
+    if err != nil {
+        return err
+    }
+    attrs = edit(attrs, name)
+
+    sb := &strings.Builder{}
+    for _, a := range attrs {
+        if strings.IndexFunc(a.value, isControl) != -1 {
+            return &WriteError{Type: "a", Rule: name, Field: "value", Err: ErrControlCharacter}
+        }
+        sb.WriteString("a=" + a.String() + "\r\n")
+    }
+    parsed := reflect.New(reflect.TypeOf(v).Elem())
+    shared := sharedFields(parsed.Elem())
+    p := &parseState{grammar: g, session: newSection(parsed.Elem(), shared)}
+    p.location = p.session
+    decoder := &Decoder{r: strings.NewReader(sb.String()), grammar: g}
+    if err := decoder.Decode(p.handle); err != nil {
+        return err
+    }
+    // the fields dropped belong to the other level, such as a=group in a
+    // media description, and would be lost
+    if len(p.session.dropped) != 0 {
+        dropped := make([]string, 0, len(p.session.dropped))
+        for key := range p.session.dropped {
+            dropped = append(dropped, key)
+        }
+        sort.Strings(dropped)
+        return &WriteError{Type: "a", Rule: dropped[0], Err: fmt.Errorf("%w: a=%s cannot be held at this level", ErrUnsupportedValue, name)}
+    }
+
+    fields := jsonFields(reflect.TypeOf(v))
+    parsedExt := shared.Extensions
+    for _, rule := range g["a"] {
+        key := rule.key()
+        if field, ok := fields[key]; ok {
+            reflect.ValueOf(v).Elem().FieldByIndex(field.Index).Set(parsed.Elem().FieldByIndex(field.Index))
+            continue
+        }
+        delete(*ext, key)
+        if value, ok := parsedExt[key]; ok {
+            if *ext == nil {
+                *ext = Extensions{}
+            }
+            (*ext)[key] = value
+        }
+    }
+    return nil
+}
@@ -0,0 +1,199 @@
+package sdp_transform
+
+import (
+    "errors"
+    "fmt"
+    "testing"
+)
+
+type testBitrate struct {
+    Min, Max int
+}
+
+func (b *testBitrate) Name() string { return "x-bitrate" }
+
+func (b *testBitrate) Unmarshal(value string) error {
+    _, err := fmt.Sscanf(value, "min=%d;max=%d", &b.Min, &b.Max)
+    return err
+}
+
+func (b *testBitrate) Marshal() string {
+    return fmt.Sprintf("min=%d;max=%d", b.Min, b.Max)
+}
+
+type testFlag struct{}
+
+func (f *testFlag) Name() string                 { return "x-conference" }
+func (f *testFlag) Unmarshal(value string) error { return nil }
+func (f *testFlag) Marshal() string              { return "" }
+
+type testNamed string
+
+func (n testNamed) Name() string                 { return string(n) }
+func (n testNamed) Unmarshal(value string) error { return nil }
+func (n testNamed) Marshal() string              { return "" }
+
+func TestRegisterAttribute(t *testing.T) {
+    g := DefaultGrammar().Clone()
+    for _, codec := range []AttributeCodec{&testBitrate{}, &testFlag{}} {
+        if err := g.RegisterAttribute(codec); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=x-conference\r\n" +
+        "m=video 54400 RTP/AVP 96\r\n" +
+        "a=x-bitrate:min=100;max=500\r\n" +
+        "a=x-bitrate:fast\r\n"
+
+    description, err := NewParser(g).Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := description.Extensions.Codec("x-conference").(*testFlag); !ok {
+        t.Fatalf("unexpected session extensions %v", description.Extensions)
+    }
+    bitrate, ok := description.Media[0].Extensions.Codec("x-bitrate").(*testBitrate)
+    if !ok || bitrate.Min != 100 || bitrate.Max != 500 {
+        t.Fatalf("unexpected media extensions %v", description.Media[0].Extensions)
+    }
+    // a value the codec cannot unmarshal is kept verbatim
+    if invalid := description.Media[0].Invalid; len(invalid) != 1 || invalid[0].Value != "x-bitrate:fast" {
+        t.Fatalf("unexpected invalid attributes %+v", invalid)
+    }
+    if out := NewWriter(g).Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    description.Media[0].Invalid = nil
+    description.Media[0].Extensions.AddCodec(&testBitrate{Min: 50, Max: 80})
+    description.Extensions.SetCodecs("x-conference")
+    expected := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=video 54400 RTP/AVP 96\r\n" +
+        "a=x-bitrate:min=100;max=500\r\n" +
+        "a=x-bitrate:min=50;max=80\r\n"
+    if out := NewWriter(g).Write(*description, nil); out != expected {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    bad := testNamed("x value")
+    mid, rtpmap, sendrecv, registered := testNamed("mid"), testNamed("rtpmap"), testNamed("sendrecv"), testNamed("x-bitrate")
+    for _, codec := range []AttributeCodec{nil, testNamed("x-value"), &bad, &mid, &rtpmap, &sendrecv, &registered} {
+        if err := g.RegisterAttribute(codec); !errors.Is(err, ErrInvalidRule) {
+            t.Fatalf("expected ErrInvalidRule for %#v, got %v", codec, err)
+        }
+    }
+}
+
+func TestAttributeAccess(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/AVP 0 96\r\n" +
+        "a=mid:0\r\n" +
+        "a=sendrecv\r\n" +
+        "a=rtpmap:0 PCMU/8000\r\n" +
+        "a=x-custom:1\r\n"
+
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    media := description.Media[0]
+    if values := media.GetAttribute("rtpmap"); len(values) != 1 || values[0] != "0 PCMU/8000" {
+        t.Fatalf("unexpected rtpmap values %q", values)
+    }
+    if values := media.GetAttribute("sendrecv"); len(values) != 1 || values[0] != "" {
+        t.Fatalf("unexpected sendrecv values %q", values)
+    }
+    if values := media.GetAttribute("x-custom"); len(values) != 1 || values[0] != "1" {
+        t.Fatalf("unexpected x-custom values %q", values)
+    }
+    if values := media.GetAttribute("ssrc"); values != nil {
+        t.Fatalf("unexpected ssrc values %q", values)
+    }
+
+    if err := media.SetAttribute("mid", "audio"); err != nil {
+        t.Fatal(err)
+    }
+    if err := media.AddAttribute("rtpmap", "96 opus/48000/2"); err != nil {
+        t.Fatal(err)
+    }
+    if err := media.RemoveAttribute("sendrecv"); err != nil {
+        t.Fatal(err)
+    }
+    if err := media.RemoveAttribute("x-custom"); err != nil {
+        t.Fatal(err)
+    }
+    if err := description.AddAttribute("group", "BUNDLE audio"); err != nil {
+        t.Fatal(err)
+    }
+    if *media.MID != "audio" || len(media.RTP) != 2 || media.RTP[1].Codec != "opus" || media.Direction != nil || media.Invalid != nil {
+        t.Fatalf("unexpected media %+v", media)
+    }
+    if len(description.Groups) != 1 || description.Groups[0].Mids != "audio" {
+        t.Fatalf("unexpected groups %+v", description.Groups)
+    }
+
+    expected := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=group:BUNDLE audio\r\n" +
+        "m=audio 54400 RTP/AVP 0 96\r\n" +
+        "a=rtpmap:0 PCMU/8000\r\n" +
+        "a=rtpmap:96 opus/48000/2\r\n" +
+        "a=mid:audio\r\n"
+    if out := Write(*description, nil); out != expected {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    for _, name := range []string{"", "a:b", "a\r\nb=c"} {
+        if err := media.AddAttribute(name, "x"); !errors.Is(err, ErrUnsupportedValue) {
+            t.Fatalf("expected ErrUnsupportedValue for %q, got %v", name, err)
+        }
+    }
+    if err := media.AddAttribute("label", "1\r\na=x"); !errors.Is(err, ErrControlCharacter) {
+        t.Fatalf("expected ErrControlCharacter, got %v", err)
+    }
+
+    // attributes of the other level would be lost
+    var writeErr *WriteError
+    if err := media.AddAttribute("group", "BUNDLE 1"); !errors.As(err, &writeErr) || writeErr.Rule != "groups" || !errors.Is(err, ErrUnsupportedValue) {
+        t.Fatalf("expected a groups WriteError, got %v", err)
+    }
+    if err := description.SetAttribute("mid", "x"); !errors.As(err, &writeErr) || writeErr.Rule != "mid" || !errors.Is(err, ErrUnsupportedValue) {
+        t.Fatalf("expected a mid WriteError, got %v", err)
+    }
+    if out := Write(*description, nil); out != expected {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    // other attributes are not stripped of control characters behind the caller's back
+    label := "a\x01b"
+    media.Label = &label
+    if err := media.SetAttribute("mid", "0"); !errors.Is(err, ErrControlCharacter) {
+        t.Fatalf("expected ErrControlCharacter, got %v", err)
+    }
+    if *media.Label != label || *media.MID != "audio" {
+        t.Fatalf("unexpected media %+v", media)
+    }
+    media.Label = nil
+
+    // a description that cannot be written is not the same as a missing attribute
+    media.RTP = append(media.RTP, nil)
+    if values := media.GetAttribute("mid"); values != nil {
+        t.Fatalf("unexpected mid values %q", values)
+    }
+    if _, err := media.GetAttributeWithError("mid"); !errors.Is(err, ErrUnsupportedValue) {
+        t.Fatalf("expected ErrUnsupportedValue, got %v", err)
+    }
+}
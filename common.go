@@ -14,9 +14,22 @@ type Origin struct {
     Address        string `json:"address"`
 }
 
+// Timing
+// A t= line and the r= lines that follow it. Start and Stop are NTP timestamps,
+// 0 meaning unbounded.
 type Timing struct {
-    Start string `json:"start"`
-    Stop  string `json:"stop"`
+    Start   string    `json:"start"`
+    Stop    string    `json:"stop"`
+    Repeats []*Repeat `json:"repeats,omitempty"`
+}
+
+// Repeat
+// An r= line. Interval, Active and every space-separated offset are seconds,
+// optionally in the compact d/h/m/s units.
+type Repeat struct {
+    Interval string `json:"interval"`
+    Active   string `json:"active"`
+    Offsets  string `json:"offsets"`
 }
 
 type Media struct {
@@ -34,23 +47,27 @@ type Media struct {
 type SessionDescription struct {
     SharedDescriptionFields
     SessionAttributes
-    Version          *string  `json:"version,omitempty"`
-    Origin           *Origin  `json:"origin,omitempty"`
-    Name             *string  `json:"name,omitempty"`
-    URI              *string  `json:"uri,omitempty"`
-    Email            *string  `json:"email,omitempty"`
-    Phone            *string  `json:"phone,omitempty"`
-    Timing           *Timing  `json:"timing,omitempty"`
-    Timezones        *string  `json:"timezones,omitempty"`
-    Repeats          *string  `json:"repeats,omitempty"`
-    Media            []*Media `json:"media,omitempty"`
-    ExtmapAllowMixed *string  `json:"extmapAllowMixed,omitempty"`
+    Version          *string   `json:"version,omitempty"`
+    Origin           *Origin   `json:"origin,omitempty"`
+    Name             *string   `json:"name,omitempty"`
+    URI              *string   `json:"uri,omitempty"`
+    Email            *string   `json:"email,omitempty"`
+    Phone            *string   `json:"phone,omitempty"`
+    Timings          []*Timing `json:"timings,omitempty"`
+    Timezones        *string   `json:"timezones,omitempty"`
+    Media            []*Media  `json:"media,omitempty"`
+    ExtmapAllowMixed *string   `json:"extmapAllowMixed,omitempty"`
+    // LineEnding is the line ending the description was parsed with.
+    LineEnding LineEnding `json:"-"`
+
+    // layout is recorded by ParseOptions.PreserveLayout.
+    layout *layout
 }
 
 type Ext struct {
     Value      string  `json:"value"`
     Direction  *string `json:"direction,omitempty"`
-    EncryptUri *string `json:"encrypt_uri,omitempty"`
+    EncryptUri *string `json:"encrypt-uri,omitempty"`
     URI        string  `json:"uri"`
     Config     *string `json:"config,omitempty"`
 }
@@ -68,6 +85,23 @@ type SourceFilter struct {
     SrcList      string `json:"srcList"`
 }
 
+// TSRefClock
+// RFC 7273 reference clock source.
+type TSRefClock struct {
+    ClkSrc    string  `json:"clksrc"`
+    ClkSrcExt *string `json:"clksrcExt,omitempty"`
+}
+
+// MediaClk
+// RFC 7273 media clock source.
+type MediaClk struct {
+    ID              *string `json:"id,omitempty"`
+    MediaClockName  *string `json:"mediaClockName,omitempty"`
+    MediaClockValue *string `json:"mediaClockValue,omitempty"`
+    RateNumerator   *string `json:"rateNumerator,omitempty"`
+    RateDenominator *string `json:"rateDenominator,omitempty"`
+}
+
 type Invalid struct {
     Value string `json:"value"`
 }
@@ -76,15 +110,18 @@ type Invalid struct {
 // These attributes can exist on both the session level and the media level.
 // https://www.iana.org/assignments/sdp-parameters/sdp-parameters.xhtml#sdp-parameters-8
 type SharedAttributes struct {
-    Direction    *string       `json:"direction,omitempty"`
-    Control      *string       `json:"control,omitempty"`
-    Ext          []*Ext        `json:"ext,omitempty"`
-    Setup        *string       `json:"setup,omitempty"`
-    IceUfrag     *string       `json:"iceUfrag,omitempty"`
-    IcePwd       *string       `json:"icePwd,omitempty"`
-    Fingerprint  *Fingerprint  `json:"fingerprint,omitempty"`
-    SourceFilter *SourceFilter `json:"sourceFilter,omitempty"`
-    Invalid      []*Invalid    `json:"invalid,omitempty"`
+    Direction      *string        `json:"direction,omitempty"`
+    Control        *string        `json:"control,omitempty"`
+    Ext            []*Ext         `json:"ext,omitempty"`
+    Setup          *string        `json:"setup,omitempty"`
+    IceUfrag       *string        `json:"iceUfrag,omitempty"`
+    IcePwd         *string        `json:"icePwd,omitempty"`
+    Fingerprints   []*Fingerprint `json:"fingerprints,omitempty"`
+    SourceFilter   *SourceFilter  `json:"sourceFilter,omitempty"`
+    ConnectionType *string        `json:"connectionType,omitempty"`
+    TSRefClocks    []*TSRefClock  `json:"tsRefClocks,omitempty"`
+    MediaClk       *MediaClk      `json:"mediaClk,omitempty"`
+    Invalid        []*Invalid     `json:"invalid,omitempty"`
 }
 
 type MsidSemantic struct {
@@ -106,6 +143,7 @@ type SessionAttributes struct {
     IceOptions   *string       `json:"iceOptions,omitempty"`
     MsidSemantic *MsidSemantic `json:"msidSemantic,omitempty"`
     Groups       []*Group      `json:"groups,omitempty"`
+    Keywords     *string       `json:"keywords,omitempty"`
 }
 
 type RTP struct {
@@ -199,6 +237,13 @@ type Simulcast struct {
     List2 *string `json:"list2,omitempty"`
 }
 
+// BFCPFloorID
+// RFC 4583 floor identifier and the media streams it is associated with.
+type BFCPFloorID struct {
+    ID      string `json:"id"`
+    MStream string `json:"mStream"`
+}
+
 type Simulcast03 struct {
     Value string `json:"value"`
 }
@@ -217,7 +262,7 @@ type MediaAttributes struct {
     MSID             *string         `json:"msid,omitempty"`
     PTIME            *string         `json:"ptime,omitempty"`
     MaxPTIME         *string         `json:"maxptime,omitempty"`
-    Crypto           *Crypto         `json:"crypto,omitempty"`
+    Crypto           []*Crypto       `json:"crypto,omitempty"`
     Candidates       []*Candidate    `json:"candidates,omitempty"`
     EndOfCandidates  *string         `json:"endOfCandidates,omitempty"`
     RemoteCandidates *string         `json:"remoteCandidates,omitempty"`
@@ -232,11 +277,31 @@ type MediaAttributes struct {
     Simulcast        *Simulcast      `json:"simulcast,omitempty"`
     Simulcast03      *Simulcast03    `json:"simulcast_03,omitempty"`
     Framerate        *string         `json:"framerate,omitempty"`
+    BundleOnly       *string         `json:"bundleOnly,omitempty"`
+    Label            *string         `json:"label,omitempty"`
+    Content          *string         `json:"content,omitempty"`
+    BFCPFloorCtrl    *string         `json:"bfcpFloorCtrl,omitempty"`
+    BFCPConfID       *string         `json:"bfcpConfId,omitempty"`
+    BFCPUserID       *string         `json:"bfcpUserId,omitempty"`
+    BFCPFloorID      *BFCPFloorID    `json:"bfcpFloorId,omitempty"`
+}
+
+// UnknownLine
+// A line whose type the grammar has no rules for, kept verbatim so that it can
+// be written back in place.
+type UnknownLine struct {
+    Type  string `json:"type"`
+    Value string `json:"value"`
 }
 
+// Connection
+// Connection data of a c= line. IP is the base address; multicast addresses may
+// carry a TTL (IP4 only) and the number of contiguous addresses in use.
 type Connection struct {
-    Version string `json:"version"`
-    IP      string `json:"ip"`
+    Version   string  `json:"version"`
+    IP        string  `json:"ip"`
+    TTL       *string `json:"ttl,omitempty"`
+    Addresses *string `json:"addresses,omitempty"`
 }
 
 type Bandwidth struct {
@@ -244,13 +309,27 @@ type Bandwidth struct {
     Limit string `json:"limit"` // string or number
 }
 
+// EncryptionKey
+// A k= line. Method is clear, base64, uri or prompt; Value is empty for prompt.
+type EncryptionKey struct {
+    Method string  `json:"method"`
+    Value  *string `json:"value,omitempty"`
+}
+
 // SharedDescriptionFields
 // Descriptor fields that exist at both the session level and media level.
 // See the SDP grammar for more details: https://tools.ietf.org/html/rfc4566#section-9
 type SharedDescriptionFields struct {
-    Description *string      `json:"description,omitempty"`
-    Connection  *Connection  `json:"connection,omitempty"`
-    Bandwidth   []*Bandwidth `json:"bandwidth,omitempty"`
+    Description   *string        `json:"description,omitempty"`
+    Connections   []*Connection  `json:"connections,omitempty"`
+    Bandwidth     []*Bandwidth   `json:"bandwidth,omitempty"`
+    EncryptionKey *EncryptionKey `json:"encryptionKey,omitempty"`
+    Unknown       []*UnknownLine `json:"unknown,omitempty"`
+    Extensions    Extensions     `json:"-"`
+
+    // grammar is the grammar the description was parsed with, nil for
+    // descriptions built by hand.
+    grammar GrammarMap
 }
 
 // MediaExtensionAttributes mediasoup used.
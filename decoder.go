@@ -0,0 +1,292 @@
+package sdp_transform
+
+import (
+    "bufio"
+    "bytes"
+    "errors"
+    "io"
+    "strings"
+    "time"
+)
+
+// ErrStopDecoding can be returned by an EventHandler to end decoding early
+// without Decode reporting an error.
+var ErrStopDecoding = errors.New("stop decoding")
+
+type EventKind int
+
+const (
+    // EventSessionLine is a session-level line other than an attribute.
+    EventSessionLine EventKind = iota
+    // EventMediaStart is an m= line opening a new media description.
+    EventMediaStart
+    // EventMediaLine is a media-level line other than m= or an attribute.
+    EventMediaLine
+    // EventAttribute is an a= line at session or media level.
+    EventAttribute
+    // EventUnknownLine is a line no grammar rule could parse. Its Type is
+    // empty when the line is blank or not of the form <type>=<value>.
+    EventUnknownLine
+)
+
+// Event
+// Describes one line of a description as it is decoded.
+type Event struct {
+    Kind EventKind
+    Line int    // 1-based line number
+    Type string // line type, e.g. "a"
+    Raw  string // line as read, before any trimming
+    // Ending is the line ending that terminated the line: "\r\n", "\n", or
+    // empty for a last line without one.
+    Ending string
+    // Media is the index of the media description the line belongs to, or -1
+    // at session level.
+    Media int
+    // Rule is the grammar rule that parsed the line, nil for unknown lines.
+    Rule *Rule
+    // Values holds what the rule captured, keyed by the rule's names, or by
+    // its name when it captures a single value. Unknown lines of the form
+    // <type>=<value> carry their value under "value".
+    Values map[string]string
+    // Trimmed reports that surrounding whitespace was removed in lenient mode.
+    Trimmed bool
+    // Attribute holds the value decoded by the AttributeCodec of the rule,
+    // for attributes registered with RegisterAttribute.
+    Attribute AttributeCodec
+
+    position *Position
+    // unmatched marks lines kept whole by a fallback rule.
+    unmatched bool
+    // control marks lines holding control characters other than tab.
+    control bool
+}
+
+type EventHandler func(ev *Event) error
+
+// Decoder
+// Reads a description line by line from an io.Reader and reports every line
+// as an Event, without building a SessionDescription.
+type Decoder struct {
+    r       io.Reader
+    options ParseOptions
+    grammar GrammarMap
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+    return NewDecoderWithOptions(r, ParseOptions{})
+}
+
+func NewDecoderWithOptions(r io.Reader, options ParseOptions) *Decoder {
+    return &Decoder{r: r, options: options, grammar: currentGrammar()}
+}
+
+// NewDecoder returns a Decoder that matches lines with the parser's grammar.
+func (p *Parser) NewDecoder(r io.Reader, options ParseOptions) *Decoder {
+    return &Decoder{r: r, options: options, grammar: p.grammar.snapshot()}
+}
+
+// Decode calls fn for every line of the description. It stops at the first
+// error returned by fn, which it passes on unless it is ErrStopDecoding.
+func (d *Decoder) Decode(fn EventHandler) error {
+    var checker *structureChecker
+    if d.options.Strict {
+        checker = newStructureChecker()
+    }
+
+    limits := &limiter{options: d.options}
+    scanner := bufio.NewScanner(d.r)
+    scanner.Split(scanLines)
+    maxToken, tooLong := limits.scanBuffer()
+    scanner.Buffer(nil, maxToken)
+    media := -1
+    lineNo := 0
+    for scanner.Scan() {
+        lineNo++
+        ev := &Event{Line: lineNo, Media: media}
+        ev.Raw, ev.Ending = splitLineEnding(scanner.Text())
+        if err := limits.line(scanner.Text(), ev.Raw); err != nil {
+            return &ParseError{Line: lineNo, Err: err}
+        }
+        line := ev.Raw
+        if d.options.Lenient {
+            line = trimLine(line)
+            ev.Trimmed = line != ev.Raw
+        }
+        if line == "" && checker == nil {
+            ev.Kind = EventUnknownLine
+            if err := fn(ev); err != nil {
+                return handlerError(err)
+            }
+            continue
+        }
+
+        typ, content, ok := splitLine(line)
+        if !ok {
+            if checker != nil {
+                return &ParseError{Line: lineNo, Raw: line, Err: ErrInvalidLine}
+            }
+            ev.Kind = EventUnknownLine
+            if err := fn(ev); err != nil {
+                return handlerError(err)
+            }
+            continue
+        }
+        ev.Type = typ
+        if err := limits.typ(typ); err != nil {
+            return &ParseError{Line: lineNo, Type: typ, Err: err}
+        }
+
+        if strings.IndexFunc(content, isControl) != -1 {
+            // Write rejects such values, so a description parsed here could
+            // not be written back
+            if checker != nil {
+                return &ParseError{Line: lineNo, Type: ev.Type, Raw: line, Err: ErrControlCharacter}
+            }
+            ev.control = true
+        }
+        if checker != nil {
+            if err := checker.check(lineNo, ev.Type, line); err != nil {
+                return err
+            }
+        }
+
+        switch {
+        case ev.Type == "m":
+            media++
+            ev.Media = media
+            ev.Kind = EventMediaStart
+        case ev.Type == "a":
+            ev.Kind = EventAttribute
+        case media == -1:
+            ev.Kind = EventSessionLine
+        default:
+            ev.Kind = EventMediaLine
+        }
+
+        var spans map[string]Span
+        if d.options.positions {
+            spans = map[string]Span{}
+        }
+        var start time.Time
+        if d.options.LineTimeout > 0 {
+            start = time.Now()
+        }
+        for _, rule := range d.grammar[ev.Type] {
+            values, err := matchRule(rule, content, spans)
+            if err == errNoMatch {
+                continue
+            }
+            if err != nil {
+                return &ParseError{Line: lineNo, Type: ev.Type, Raw: line, Rule: rule.key(), Err: err}
+            }
+            if rule.codec != nil {
+                codec, err := decodeAttribute(rule, values["value"])
+                if err != nil {
+                    // left to the rules after it, in the end the catch-all
+                    continue
+                }
+                ev.Attribute = codec
+            }
+            ev.Rule, ev.Values = rule, values
+            if checker != nil {
+                if field, err := checkNumbers(rule, ev.Values); err != nil {
+                    parseErr := numberError(numberField(rule, field), ev.Values[field], err)
+                    parseErr.Line, parseErr.Type = lineNo, ev.Type
+                    return parseErr
+                }
+            }
+            break
+        }
+        if d.options.LineTimeout > 0 {
+            if err := limits.matched(start); err != nil {
+                return &ParseError{Line: lineNo, Type: ev.Type, Err: err}
+            }
+        }
+
+        if ev.Rule == nil {
+            if checker != nil && len(d.grammar[ev.Type]) != 0 {
+                return &ParseError{Line: lineNo, Type: ev.Type, Raw: line, Err: ErrMalformedLine}
+            }
+            if ev.Kind == EventMediaStart {
+                // an m= line the grammar cannot parse still opens a media description
+                ev.Rule = d.grammar["m"][0]
+                ev.Values = map[string]string{}
+            } else if rule := fallbackRule(d.grammar[ev.Type]); rule != nil {
+                ev.Rule = rule
+                ev.Values = map[string]string{rule.Name: content}
+                ev.unmatched = true
+            } else {
+                ev.Kind = EventUnknownLine
+                ev.Values = map[string]string{"value": content}
+            }
+        }
+        if d.options.positions {
+            ev.position = newPosition(ev, line, spans)
+        }
+        if err := fn(ev); err != nil {
+            return handlerError(err)
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        if errors.Is(err, bufio.ErrTooLong) && tooLong != nil {
+            err = tooLong
+        }
+        return &ParseError{Line: lineNo + 1, Err: err}
+    }
+    if checker != nil {
+        return checker.finish()
+    }
+    return nil
+}
+
+// fallbackRule returns the rule that keeps unmatched lines of a type, if any.
+func fallbackRule(rules []*Rule) *Rule {
+    for _, rule := range rules {
+        if rule.fallback {
+            return rule
+        }
+    }
+    return nil
+}
+
+func handlerError(err error) error {
+    if errors.Is(err, ErrStopDecoding) {
+        return nil
+    }
+    return err
+}
+
+// scanLines is bufio.ScanLines keeping the line ending in the token.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+    if atEOF && len(data) == 0 {
+        return 0, nil, nil
+    }
+    if i := bytes.IndexByte(data, '\n'); i >= 0 {
+        return i + 1, data[:i+1], nil
+    }
+    if atEOF {
+        return len(data), data, nil
+    }
+    return 0, nil, nil
+}
+
+func splitLineEnding(line string) (string, string) {
+    switch {
+    case strings.HasSuffix(line, "\r\n"):
+        return line[:len(line)-2], "\r\n"
+    case strings.HasSuffix(line, "\n"):
+        return line[:len(line)-1], "\n"
+    case strings.HasSuffix(line, "\r"):
+        return line[:len(line)-1], "\r"
+    }
+    return line, ""
+}
+
+// splitLine splits a <type>=<value> line, the type being a single lowercase
+// letter.
+func splitLine(line string) (string, string, bool) {
+    if len(line) < 2 || line[0] < 'a' || line[0] > 'z' || line[1] != '=' {
+        return "", "", false
+    }
+    return line[:1], line[2:], true
+}
@@ -0,0 +1,58 @@
+package sdp_transform
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestDecoder(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=group:BUNDLE 0 1\r\n" +
+        "m=audio 54400 RTP/SAVPF 0\r\n" +
+        "c=IN IP4 203.0.113.1\r\n" +
+        "a=mid:0\r\n" +
+        "y=vendor\r\n" +
+        "m=video 55400 RTP/SAVPF 97\r\n" +
+        "a=mid:1\r\n"
+
+    kinds := map[EventKind]int{}
+    var mids []string
+    err := NewDecoder(strings.NewReader(sdp)).Decode(func(ev *Event) error {
+        kinds[ev.Kind]++
+        if ev.Kind == EventAttribute && ev.Rule.Name == "mid" {
+            mids = append(mids, ev.Values["mid"])
+            if ev.Media != len(mids)-1 {
+                t.Errorf("mid %s reported for media %d", ev.Values["mid"], ev.Media)
+            }
+        }
+        if ev.Kind == EventMediaStart && ev.Values["type"] == "" {
+            t.Errorf("media start without type at line %d", ev.Line)
+        }
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if kinds[EventSessionLine] != 4 || kinds[EventMediaStart] != 2 || kinds[EventMediaLine] != 1 ||
+        kinds[EventAttribute] != 3 || kinds[EventUnknownLine] != 1 {
+        t.Fatalf("unexpected event counts %v", kinds)
+    }
+    if strings.Join(mids, ",") != "0,1" {
+        t.Fatalf("unexpected mids %v", mids)
+    }
+
+    lines := 0
+    err = NewDecoder(strings.NewReader(sdp)).Decode(func(ev *Event) error {
+        lines++
+        if ev.Kind == EventMediaStart {
+            return ErrStopDecoding
+        }
+        return nil
+    })
+    if err != nil || lines != 6 {
+        t.Fatalf("expected to stop at line 6, got %d lines and %v", lines, err)
+    }
+}
@@ -0,0 +1,53 @@
+package sdp_transform
+
+import "fmt"
+
+type DiagnosticKind string
+
+const (
+    // DiagnosticSkippedLine is a line that is not of the form <type>=<value>.
+    DiagnosticSkippedLine DiagnosticKind = "skipped-line"
+    // DiagnosticUnknownLineType is a line whose type has no grammar rules.
+    DiagnosticUnknownLineType DiagnosticKind = "unknown-line-type"
+    // DiagnosticUnmatchedLine is a line that none of its type's rules matched.
+    DiagnosticUnmatchedLine DiagnosticKind = "unmatched-line"
+    // DiagnosticInvalidAttribute is an a= line kept verbatim in Invalid.
+    DiagnosticInvalidAttribute DiagnosticKind = "invalid-attribute"
+    // DiagnosticDroppedField is a parsed value the struct model cannot hold.
+    DiagnosticDroppedField DiagnosticKind = "dropped-field"
+    // DiagnosticInvalidNumber is a numeric value that does not fit its type.
+    DiagnosticInvalidNumber DiagnosticKind = "invalid-number"
+    // DiagnosticTrimmedWhitespace is a line whose surrounding whitespace was trimmed.
+    DiagnosticTrimmedWhitespace DiagnosticKind = "trimmed-whitespace"
+    // DiagnosticControlCharacter is a line holding control characters, which
+    // Write rejects unless told to strip them.
+    DiagnosticControlCharacter DiagnosticKind = "control-character"
+)
+
+// Diagnostic
+// Records an interop problem that lenient parsing worked around.
+type Diagnostic struct {
+    Kind    DiagnosticKind
+    Line    int    // 1-based line number, 0 when not tied to a line
+    Type    string // line type, if known
+    Raw     string // raw line, if any
+    Rule    string // grammar rule or field involved, if any
+    Message string
+}
+
+func (d Diagnostic) String() string {
+    msg := string(d.Kind)
+    if d.Line != 0 {
+        msg = fmt.Sprintf("line %d: %s", d.Line, msg)
+    }
+    if d.Rule != "" {
+        msg = fmt.Sprintf("%s (rule %q)", msg, d.Rule)
+    }
+    if d.Raw != "" {
+        msg = fmt.Sprintf("%s in %q", msg, d.Raw)
+    }
+    if d.Message != "" {
+        msg = fmt.Sprintf("%s: %s", msg, d.Message)
+    }
+    return msg
+}
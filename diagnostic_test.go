@@ -0,0 +1,49 @@
+package sdp_transform
+
+import (
+    "testing"
+)
+
+func TestParseLenient(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s= \r\n" +
+        "t=0 0 \r\n" +
+        "garbage\r\n" +
+        "a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR|2^20|1:32\r\n" +
+        "m=audio 54400 RTP/SAVP 0\r\n" +
+        "a=x-custom:1\r\n" +
+        "a=bundle-only\r\n" +
+        "a=label:a\x01b\r\n"
+
+    session, diagnostics, err := ParseLenient(sdp)
+    if err != nil {
+        t.Fatalf("lenient parse failed: %v", err)
+    }
+    if *session.Name != " " || session.Timings[0].Stop != "0" || len(session.Media) != 1 {
+        t.Fatalf("unexpected session %+v", session)
+    }
+
+    expected := []struct {
+        kind DiagnosticKind
+        line int
+        rule string
+    }{
+        {DiagnosticTrimmedWhitespace, 4, ""},
+        {DiagnosticSkippedLine, 5, ""},
+        {DiagnosticInvalidAttribute, 8, "invalid"},
+        {DiagnosticDroppedField, 6, "crypto"},
+        {DiagnosticControlCharacter, 10, ""},
+    }
+    for _, e := range expected {
+        found := false
+        for _, d := range diagnostics {
+            if d.Kind == e.kind && d.Line == e.line && d.Rule == e.rule {
+                found = true
+            }
+        }
+        if !found {
+            t.Errorf("missing diagnostic %s at line %d (%s) in %v", e.kind, e.line, e.rule, diagnostics)
+        }
+    }
+}
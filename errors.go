@@ -0,0 +1,91 @@
+package sdp_transform
+
+import (
+    "errors"
+    "fmt"
+)
+
+var (
+    errNoMatch = errors.New("line does not match rule")
+
+    // ErrIncompleteRemoteCandidate is reported when a remote-candidates list is
+    // not made of complete "component ip port" triples.
+    ErrIncompleteRemoteCandidate = errors.New("incomplete remote candidate")
+
+    // ErrUnsupportedValue is reported by the writer for values it cannot turn
+    // into text, such as a nil list element or a struct in an interface{}
+    // field.
+    ErrUnsupportedValue = errors.New("unsupported value")
+
+    // ErrControlCharacter is reported by the writer for values containing a
+    // line break or another control character, see SanitizePolicy, and by
+    // strict parsing for lines containing one.
+    ErrControlCharacter = errors.New("value contains a control character")
+
+    // ErrInvalidTag is reported by Unmarshal and Marshal for sdp struct tags
+    // and field types they cannot use.
+    ErrInvalidTag = errors.New("invalid sdp tag")
+)
+
+// ParseError
+// Describes an SDP line that could not be parsed. Use errors.As to retrieve it
+// from the error returned by Parse and the Parse* helpers.
+type ParseError struct {
+    Line int    // 1-based line number, 0 when the input is not a whole description
+    Type string // line type, e.g. "a" for attributes
+    Raw  string // raw line or value that failed
+    Rule string // name or push target of the grammar rule that failed
+    Err  error
+}
+
+func (e *ParseError) Error() string {
+    msg := "sdp: parse error"
+    if e.Line != 0 {
+        msg = fmt.Sprintf("%s at line %d", msg, e.Line)
+    }
+    if e.Rule != "" {
+        msg = fmt.Sprintf("%s (rule %q)", msg, e.Rule)
+    }
+    if e.Raw != "" {
+        msg = fmt.Sprintf("%s in %q", msg, e.Raw)
+    }
+    if e.Err != nil {
+        msg = fmt.Sprintf("%s: %v", msg, e.Err)
+    }
+    return msg
+}
+
+func (e *ParseError) Unwrap() error {
+    return e.Err
+}
+
+// WriteError
+// Describes a value of a description that could not be written. Use errors.As
+// to retrieve it from the error returned by WriteWithError and WriteTo.
+type WriteError struct {
+    Type  string // line type, e.g. "a" for attributes
+    Rule  string // name or push target of the grammar rule that failed
+    Field string // field of the rule, or of the description, that failed
+    Err   error
+}
+
+func (e *WriteError) Error() string {
+    msg := "sdp: write error"
+    if e.Type != "" {
+        msg = fmt.Sprintf("%s in %s= line", msg, e.Type)
+    }
+    if e.Rule != "" {
+        msg = fmt.Sprintf("%s (rule %q)", msg, e.Rule)
+    }
+    if e.Field != "" {
+        msg = fmt.Sprintf("%s at field %q", msg, e.Field)
+    }
+    if e.Err != nil {
+        msg = fmt.Sprintf("%s: %v", msg, e.Err)
+    }
+    return msg
+}
+
+func (e *WriteError) Unwrap() error {
+    return e.Err
+}
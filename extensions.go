@@ -0,0 +1,172 @@
+package sdp_transform
+
+import (
+    "fmt"
+    "reflect"
+)
+
+// Extensions
+// Values of rules added with RegisterRule, keyed by the rule's name or push
+// target. A named rule without names stores a string, a named rule with names a
+// map[string]string, a push rule a []map[string]string, and an attribute
+// registered with RegisterAttribute a []AttributeCodec.
+type Extensions map[string]interface{}
+
+// String returns the value of a named rule without names.
+func (e Extensions) String(key string) (string, bool) {
+    s, ok := e[key].(string)
+    return s, ok
+}
+
+// Values returns the values of a named rule with names.
+func (e Extensions) Values(key string) (map[string]string, bool) {
+    m, ok := e[key].(map[string]string)
+    return m, ok
+}
+
+// List returns the elements of a push rule, one per line.
+func (e Extensions) List(key string) ([]map[string]string, bool) {
+    list, ok := e[key].([]map[string]string)
+    return list, ok
+}
+
+// Decode stores the value of key in v, which points to a string, a struct
+// pointer or a slice of struct pointers. Struct fields are matched by json tag,
+// as in the built-in types.
+func (e Extensions) Decode(key string, v interface{}) error {
+    rv := reflect.ValueOf(v)
+    if rv.Kind() != reflect.Ptr || rv.IsNil() {
+        return fmt.Errorf("%w: cannot decode into %T", ErrUnsupportedValue, v)
+    }
+    value, ok := e[key]
+    if !ok {
+        return nil
+    }
+    value = extensionToSection(value)
+    if !decodeValue(value, rv.Elem()) {
+        return &fieldError{field: key, value: value, typ: rv.Elem().Type()}
+    }
+    return nil
+}
+
+// Encode sets key from v, a string, a struct pointer or a slice of struct
+// pointers, the counterpart of Decode. A nil v removes the key.
+func (e Extensions) Encode(key string, v interface{}) error {
+    value, ok, err := encodeValue(reflect.ValueOf(v), reflect.StructField{})
+    if err != nil {
+        return &WriteError{Rule: key, Err: err}
+    }
+    if !ok {
+        if v != nil {
+            return &WriteError{Rule: key, Err: fmt.Errorf("%w: %T", ErrUnsupportedValue, v)}
+        }
+        delete(e, key)
+        return nil
+    }
+    converted, err := sectionToExtension(value)
+    if err != nil {
+        return &WriteError{Rule: key, Err: err}
+    }
+    e[key] = converted
+    return nil
+}
+
+// add stores the values a registered rule captured from a line, and codec when
+// the rule belongs to an AttributeCodec. It returns the index of the new list
+// element, or -1 for named rules.
+func (e *Extensions) add(rule *Rule, values map[string]string, codec AttributeCodec) int {
+    if *e == nil {
+        *e = Extensions{}
+    }
+    key := rule.key()
+    switch {
+    case rule.codec != nil:
+        codecs := append(e.Codecs(key), codec)
+        (*e)[key] = codecs
+        return len(codecs) - 1
+    case rule.Push != "":
+        list, _ := e.List(key)
+        list = append(list, values)
+        (*e)[key] = list
+        return len(list) - 1
+    case len(rule.Names) != 0:
+        m, ok := e.Values(key)
+        if !ok {
+            m = make(map[string]string, len(values))
+            (*e)[key] = m
+        }
+        for k, v := range values {
+            m[k] = v
+        }
+    default:
+        (*e)[key] = values[rule.Name]
+    }
+    return -1
+}
+
+// extensionToSection converts an extension value to the shape decodeValue
+// reads.
+func extensionToSection(value interface{}) interface{} {
+    toMap := func(m map[string]string) map[string]interface{} {
+        values := make(map[string]interface{}, len(m))
+        for k, v := range m {
+            values[k] = v
+        }
+        return values
+    }
+    switch value := value.(type) {
+    case map[string]string:
+        return toMap(value)
+    case []map[string]string:
+        list := make([]map[string]interface{}, 0, len(value))
+        for _, m := range value {
+            list = append(list, toMap(m))
+        }
+        return list
+    }
+    return value
+}
+
+// sectionToExtension converts a value encoded from a struct to an extension
+// value.
+func sectionToExtension(value interface{}) (interface{}, error) {
+    toMap := func(m map[string]interface{}) (map[string]string, error) {
+        values := make(map[string]string, len(m))
+        for k, v := range m {
+            s, err := lineValue(v)
+            if err != nil {
+                return nil, err
+            }
+            values[k] = s
+        }
+        return values, nil
+    }
+    switch value := value.(type) {
+    case string:
+        return value, nil
+    case map[string]interface{}:
+        return toMap(value)
+    case []map[string]interface{}:
+        list := make([]map[string]string, 0, len(value))
+        for _, m := range value {
+            el, err := toMap(m)
+            if err != nil {
+                return nil, err
+            }
+            list = append(list, el)
+        }
+        return list, nil
+    case []interface{}:
+        list := make([]map[string]string, 0, len(value))
+        for _, m := range value {
+            values, _ := m.(map[string]interface{})
+            el, err := toMap(values)
+            if err != nil {
+                return nil, err
+            }
+            list = append(list, el)
+        }
+        return list, nil
+    }
+    return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, value)
+}
@@ -0,0 +1,118 @@
+package sdp_transform
+
+import (
+    "errors"
+    "fmt"
+    "regexp"
+    "testing"
+)
+
+type testStream struct {
+    ID    string  `json:"id"`
+    Label *string `json:"label,omitempty"`
+}
+
+func TestRegisterRule(t *testing.T) {
+    defer defaultGrammar.rules.Store(grammarMap)
+
+    if err := RegisterRule("a", &Rule{
+        Name: "region",
+        Reg:  regexp.MustCompile(`^x-region:(.*)`),
+        Format: func(m map[string]string) string {
+            return "x-region:%s"
+        },
+    }); err != nil {
+        t.Fatal(err)
+    }
+    if err := RegisterRule("a", &Rule{
+        Push:  "streams",
+        Reg:   regexp.MustCompile(`^x-stream:(\S+)(?: (.*))?`),
+        Names: []string{"id", "label"},
+        Format: func(m map[string]string) string {
+            if m["label"] != "" {
+                return "x-stream:%s %s"
+            }
+            return "x-stream:%s"
+        },
+    }); err != nil {
+        t.Fatal(err)
+    }
+
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=x-region:eu-west\r\n" +
+        "m=video 54400 RTP/AVP 96\r\n" +
+        "a=x-stream:1 main\r\n" +
+        "a=x-stream:2\r\n" +
+        "a=x-unregistered\r\n"
+
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if region, ok := description.Extensions.String("region"); !ok || region != "eu-west" {
+        t.Fatalf("unexpected region %q", region)
+    }
+    list, ok := description.Media[0].Extensions.List("streams")
+    if !ok || len(list) != 2 || list[0]["label"] != "main" {
+        t.Fatalf("unexpected streams %v", list)
+    }
+    if len(description.Media[0].Invalid) != 1 {
+        t.Fatalf("unexpected invalid attributes %+v", description.Media[0].Invalid)
+    }
+
+    var streams []*testStream
+    if err := description.Media[0].Extensions.Decode("streams", &streams); err != nil {
+        t.Fatal(err)
+    }
+    if len(streams) != 2 || streams[0].ID != "1" || *streams[0].Label != "main" || streams[1].Label != nil {
+        t.Fatalf("unexpected decoded streams %+v", streams)
+    }
+
+    if out := Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    label := "backup"
+    streams = append(streams, &testStream{ID: "3", Label: &label})
+    if err := description.Media[0].Extensions.Encode("streams", streams); err != nil {
+        t.Fatal(err)
+    }
+    if err := description.Extensions.Encode("region", nil); err != nil {
+        t.Fatal(err)
+    }
+    expected := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=video 54400 RTP/AVP 96\r\n" +
+        "a=x-stream:1 main\r\n" +
+        "a=x-stream:2\r\n" +
+        "a=x-stream:3 backup\r\n" +
+        "a=x-unregistered\r\n"
+    if out := Write(*description, nil); out != expected {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+}
+
+func TestRegisterRuleErrors(t *testing.T) {
+    defer defaultGrammar.rules.Store(grammarMap)
+
+    for _, test := range []struct {
+        typ  string
+        rule *Rule
+    }{
+        {"a", nil},
+        {"a", &Rule{}},
+        {"y", &Rule{Name: "why"}},
+        {"r", &Rule{Push: "extra", Parent: "timings"}},
+    } {
+        t.Run(fmt.Sprintf("%s %+v", test.typ, test.rule), func(t *testing.T) {
+            if err := RegisterRule(test.typ, test.rule); !errors.Is(err, ErrInvalidRule) {
+                t.Fatalf("expected ErrInvalidRule, got %v", err)
+            }
+        })
+    }
+}
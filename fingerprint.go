@@ -0,0 +1,34 @@
+package sdp_transform
+
+import (
+    "strings"
+)
+
+// RFC 8122 hash function names, weakest first.
+var fingerprintHashes = []string{"md2", "md5", "sha-1", "sha-224", "sha-256", "sha-384", "sha-512"}
+
+func fingerprintStrength(hash string) int {
+    hash = strings.ToLower(hash)
+    for i, h := range fingerprintHashes {
+        if h == hash {
+            return i + 1
+        }
+    }
+    return 0
+}
+
+// StrongestFingerprint returns the fingerprint with the strongest hash
+// function, preferring the first one listed on a tie, or nil when there are
+// none. Nil entries are skipped.
+func (a *SharedAttributes) StrongestFingerprint() *Fingerprint {
+    var strongest *Fingerprint
+    for _, fingerprint := range a.Fingerprints {
+        if fingerprint == nil {
+            continue
+        }
+        if strongest == nil || fingerprintStrength(fingerprint.Type) > fingerprintStrength(strongest.Type) {
+            strongest = fingerprint
+        }
+    }
+    return strongest
+}
@@ -0,0 +1,42 @@
+package sdp_transform
+
+import (
+    "testing"
+)
+
+func TestFingerprints(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=fingerprint:SHA-1 4A:AD:B9:B1:3F:82:18:3B:54:02:12:DF:3E:5D:49:6B:19:E5:7C:AB\r\n" +
+        "a=fingerprint:sha-256 45:A7:FA:D6:EE:39:58:CD:77:4E:DD:26:C7:06:42:20:EB:34:E8:83:B8:26:41:E1:EE:63:27:DA:01:72:40:04\r\n" +
+        "m=audio 54400 UDP/TLS/RTP/SAVPF 0\r\n" +
+        "a=fingerprint:sha-1 4A:AD:B9:B1:3F:82:18:3B:54:02:12:DF:3E:5D:49:6B:19:E5:7C:AB\r\n"
+
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(description.Fingerprints) != 2 || len(description.Media[0].Fingerprints) != 1 {
+        t.Fatalf("unexpected fingerprints %+v %+v", description.Fingerprints, description.Media[0].Fingerprints)
+    }
+    if strongest := description.StrongestFingerprint(); strongest.Type != "sha-256" {
+        t.Fatalf("unexpected strongest fingerprint %+v", strongest)
+    }
+    if strongest := description.Media[0].StrongestFingerprint(); strongest.Type != "sha-1" {
+        t.Fatalf("unexpected strongest media fingerprint %+v", strongest)
+    }
+    if out := Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    // slices built by hand may hold nil entries
+    attributes := SharedAttributes{Fingerprints: []*Fingerprint{nil, {Type: "sha-1"}, nil}}
+    if strongest := attributes.StrongestFingerprint(); strongest == nil || strongest.Type != "sha-1" {
+        t.Fatalf("unexpected strongest fingerprint %+v", strongest)
+    }
+    if strongest := (&SharedAttributes{Fingerprints: []*Fingerprint{nil}}).StrongestFingerprint(); strongest != nil {
+        t.Fatalf("unexpected strongest fingerprint %+v", strongest)
+    }
+}
@@ -1,5 +1,3 @@
 module github.com/seamory/sdp-transform-go
 
 go 1.13
-
-require github.com/dlclark/regexp2 v1.11.5 // indirect
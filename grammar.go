@@ -1,8 +1,13 @@
 package sdp_transform
 
 import (
-    "github.com/dlclark/regexp2"
+    "errors"
+    "fmt"
+    "reflect"
+    "regexp"
     "strings"
+    "sync"
+    "sync/atomic"
 )
 
 type MapStringString map[string]string
@@ -16,32 +21,51 @@ func (m MapStringString) has(key string) bool {
 }
 
 type Rule struct {
-    Name   string
-    Push   string
-    Reg    *regexp2.Regexp
+    Name string
+    Push string
+    // Parent nests the values of a push rule under the last element of the
+    // list another push rule builds, e.g. r= lines under their t= line.
+    Parent string
+    Reg    *regexp.Regexp
     Names  []string
     Format func(m map[string]string) string
+
+    // registered marks rules added with RegisterRule.
+    registered bool
+    // codec is the pointer type of the AttributeCodec of rules added with
+    // RegisterAttribute.
+    codec reflect.Type
+    // check rejects values the rule would write as a line that parses back
+    // differently, returning the offending name.
+    check func(m map[string]string) (string, error)
+    // fallback keeps the content of lines the regexp does not match under the
+    // rule's name, except in strict mode.
+    fallback bool
+}
+
+// key returns the name the rule stores its result under.
+func (r *Rule) key() string {
+    if r.Push != "" {
+        return r.Push
+    }
+    return r.Name
 }
 
 // https://github.com/clux/sdp-transform/blob/master/lib/grammar.js
 
 type GrammarMap map[string][]*Rule
 
-func regexp2MustCompile(str string) *regexp2.Regexp {
-    return regexp2.MustCompile(str, regexp2.None)
-}
-
 var grammarMap GrammarMap = map[string][]*Rule{
     "v": {
         {
             Name: "version",
-            Reg:  regexp2MustCompile(`^(\d*)$`),
+            Reg:  regexp.MustCompile(`^(\d*)$`),
         },
     },
     "o": {
         {
             Name:  "origin",
-            Reg:   regexp2MustCompile(`^(\S*) (\d*) (\d*) (\S*) IP(\d) (\S*)`),
+            Reg:   regexp.MustCompile(`^(\S*) (\d*) (\d*) (\S*) IP(\d) (\S*)`),
             Names: []string{"username", "sessionId", "sessionVersion", "netType", "ipVer", "address"},
             Format: func(m map[string]string) string {
                 return "%s %s %d %s IP%d %s"
@@ -75,19 +99,32 @@ var grammarMap GrammarMap = map[string][]*Rule{
     },
     "z": {
         {
+            // z=2882844526 -1h 2898848070 0
             Name: "timezones",
+            Reg:  regexp.MustCompile(`^(\d+ -?\d+[dhms]?(?: \d+ -?\d+[dhms]?)*)$`),
+            // z= used to be kept as written; malformed lines still are
+            fallback: true,
         },
     },
     "r": {
         {
-            Name: "repeats",
+            // r=7d 1h 0 25h
+            // r=604800 3600 0 90000
+            Push:   "repeats",
+            Parent: "timings",
+            Reg:    regexp.MustCompile(`^(\d+[dhms]?) (\d+[dhms]?) (-?\d+[dhms]?(?: -?\d+[dhms]?)*)$`),
+            Names:  []string{"interval", "active", "offsets"},
+            Format: func(m map[string]string) string {
+                return "%s %s %s"
+            },
         },
     },
     "t": {
         {
             // t=0 0
-            Name:  "timing",
-            Reg:   regexp2MustCompile(`^(\d*) (\d*)`),
+            // t=3034423619 3042462419
+            Push:  "timings",
+            Reg:   regexp.MustCompile(`^(\d*) (\d*)`),
             Names: []string{"start", "stop"},
             Format: func(m map[string]string) string {
                 return "%d %d"
@@ -97,11 +134,36 @@ var grammarMap GrammarMap = map[string][]*Rule{
     "c": {
         {
             // c=IN IP4 10.47.197.26
-            Name:  "connection",
-            Reg:   regexp2MustCompile(`^IN IP(\d) (\S*)`),
-            Names: []string{"version", "ip"},
-            Format: func(m map[string]string) string {
-                return "IN IP%d %s"
+            // c=IN IP4 224.2.1.1/127/3
+            // c=IN IP6 ff15::101/3
+            // IP4 multicast addresses carry a TTL before the address count, IP6 ones do not.
+            // Both branches capture into the same names; this relies on matchRule
+            // skipping the groups of the branch that did not match.
+            Push:  "connections",
+            Reg:   regexp.MustCompile(`^IN IP(?:(4) ([^\s/]*)(?:/(\d+))?(?:/(\d+))?|(\d) ([^\s/]*)(?:/(\d+))?)`),
+            Names: []string{"version", "ip", "ttl", "addresses", "version", "ip", "addresses"},
+            Format: func(m map[string]string) string {
+                str := "IN IP%d %s"
+                if m["ttl"] != "" {
+                    str += "/%d"
+                } else {
+                    str += "%v"
+                }
+                if m["addresses"] != "" {
+                    str += "/%d"
+                }
+                return str
+            },
+            // an IP4 address count without a TTL would be read back as the TTL,
+            // and an IP6 TTL as the address count
+            check: func(m map[string]string) (string, error) {
+                if m["version"] == "4" && m["addresses"] != "" && m["ttl"] == "" {
+                    return "ttl", fmt.Errorf("%w: IP4 address count without a TTL", ErrUnsupportedValue)
+                }
+                if m["version"] != "4" && m["ttl"] != "" {
+                    return "ttl", fmt.Errorf("%w: TTL on an IP%s address", ErrUnsupportedValue, m["version"])
+                }
+                return "", nil
             },
         },
     },
@@ -109,19 +171,36 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // b=AS:4000
             Push:  "bandwidth",
-            Reg:   regexp2MustCompile(`^(TIAS|AS|CT|RR|RS):(\d*)`),
+            Reg:   regexp.MustCompile(`^(TIAS|AS|CT|RR|RS):(\d*)`),
             Names: []string{"type", "limit"},
             Format: func(m map[string]string) string {
                 return "%s:%s"
             },
         },
     },
+    "k": {
+        {
+            // k=clear:secret
+            // k=base64:c2VjcmV0
+            // k=uri:https://keys.example.com/session
+            // k=prompt
+            Name:  "encryptionKey",
+            Reg:   regexp.MustCompile(`^([^:]+)(?::(.*))?$`),
+            Names: []string{"method", "value"},
+            Format: func(m map[string]string) string {
+                if m["value"] != "" {
+                    return "%s:%s"
+                }
+                return "%s"
+            },
+        },
+    },
     "m": {
         {
             // m=video 51744 RTP/AVP 126 97 98 34 31
             // NB: special - pushes to session
             // TODO: rtp/fmtp should be filtered by the payloads found here?
-            Reg:   regexp2MustCompile(`^(\w*) (\d*) ([\w/]*)(?: (.*))?`),
+            Reg:   regexp.MustCompile(`^(\w*) (\d*) ([\w/]*)(?: (.*))?`),
             Names: []string{"type", "port", "protocol", "payloads"},
             Format: func(m map[string]string) string {
                 return "%s %d %s %s"
@@ -132,7 +211,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=rtpmap:110 opus/48000/2
             Push:  "rtp",
-            Reg:   regexp2MustCompile(`^rtpmap:(\d*) ([\w\-.]*)(?:\s*\/(\d*)(?:\s*\/(\S*))?)?`),
+            Reg:   regexp.MustCompile(`^rtpmap:(\d*) ([\w\-.]*)(?:\s*\/(\d*)(?:\s*\/(\S*))?)?`),
             Names: []string{"payload", "codec", "rate", "encoding"},
             Format: func(m map[string]string) string {
                 mss := MapStringString(m)
@@ -149,7 +228,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=fmtp:108 profile-level-id=24;object=23;bitrate=64000
             // a=fmtp:111 minptime=10; useinbandfec=1
             Push:  "fmtp",
-            Reg:   regexp2MustCompile(`^fmtp:(\d*) ([\S| ]*)`),
+            Reg:   regexp.MustCompile(`^fmtp:(\d*) ([\S| ]*)`),
             Names: []string{"payload", "config"},
             Format: func(m map[string]string) string {
                 return "fmtp:%d %s"
@@ -158,7 +237,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=control:streamid=0
             Name: "control",
-            Reg:  regexp2MustCompile(`^control:(.*)`),
+            Reg:  regexp.MustCompile(`^control:(.*)`),
             Format: func(m map[string]string) string {
                 return "control:%s"
             },
@@ -166,7 +245,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=rtcp:65179 IN IP4 193.84.77.194
             Name:  "rtcp",
-            Reg:   regexp2MustCompile(`^rtcp:(\d*)(?: (\S*) IP(\d) (\S*))?`),
+            Reg:   regexp.MustCompile(`^rtcp:(\d*)(?: (\S*) IP(\d) (\S*))?`),
             Names: []string{"port", "netType", "ipVer", "address"},
             Format: func(m map[string]string) string {
                 mss := MapStringString(m)
@@ -179,7 +258,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=rtcp-fb:98 trr-int 100
             Push:  "rtcpFbTrrInt",
-            Reg:   regexp2MustCompile(`^rtcp-fb:(\*|\d*) trr-int (\d*)`),
+            Reg:   regexp.MustCompile(`^rtcp-fb:(\*|\d*) trr-int (\d*)`),
             Names: []string{"payload", "value"},
             Format: func(m map[string]string) string {
                 return "rtcp-fb:%s trr-int %d"
@@ -188,7 +267,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=rtcp-fb:98 nack rpsi
             Push:  "rtcpFb",
-            Reg:   regexp2MustCompile(`^rtcp-fb:(\*|\d*) ([\w-_]*)(?: ([\w-_]*))?`),
+            Reg:   regexp.MustCompile(`^rtcp-fb:(\*|\d*) ([\w-_]*)(?: ([\w-_]*))?`),
             Names: []string{"payload", "type", "subtype"},
             Format: func(m map[string]string) string {
                 mss := MapStringString(m)
@@ -203,7 +282,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=extmap:1/recvonly URI-gps-string
             // a=extmap:3 urn:ietf:params:rtp-hdrext:encrypt urn:ietf:params:rtp-hdrext:smpte-tc 25@600/24
             Push:  "ext",
-            Reg:   regexp2MustCompile(`^extmap:(\d+)(?:\/(\w+))?(?: (urn:ietf:params:rtp-hdrext:encrypt))? (\S*)(?: (\S*))?`),
+            Reg:   regexp.MustCompile(`^extmap:(\d+)(?:\/(\w+))?(?: (urn:ietf:params:rtp-hdrext:encrypt))? (\S*)(?: (\S*))?`),
             Names: []string{"value", "direction", "encrypt-uri", "uri", "config"},
             Format: func(m map[string]string) string {
                 sb := strings.Builder{}
@@ -226,7 +305,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
                 sb.WriteString(" %s")
 
                 if mss.has("config") {
-                    sb.WriteString("%s")
+                    sb.WriteString(" %s")
                 }
 
                 return sb.String()
@@ -235,11 +314,11 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=extmap-allow-mixed
             Name: "extmapAllowMixed",
-            Reg:  regexp2MustCompile(`^(extmap-allow-mixed)`),
+            Reg:  regexp.MustCompile(`^(extmap-allow-mixed)`),
         },
         {
             Push:  "crypto",
-            Reg:   regexp2MustCompile(`^crypto:(\d*) ([\w_]*) (\S*)(?: (\S*))?`),
+            Reg:   regexp.MustCompile(`^crypto:(\d*) ([\w_]*) (\S*)(?: (\S*))?`),
             Names: []string{"id", "suite", "config", "sessionConfig"},
             Format: func(m map[string]string) string {
                 mss := MapStringString(m)
@@ -253,7 +332,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=setup:actpass
             Name: "setup",
-            Reg:  regexp2MustCompile(`^setup:(\w*)`),
+            Reg:  regexp.MustCompile(`^setup:(\w*)`),
             Format: func(m map[string]string) string {
                 return "setup:%s"
             },
@@ -261,7 +340,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=connection:new
             Name: "connectionType",
-            Reg:  regexp2MustCompile(`^connection:(new|existing)`),
+            Reg:  regexp.MustCompile(`^connection:(new|existing)`),
             Format: func(m map[string]string) string {
                 return "connection:%s"
             },
@@ -269,7 +348,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=mid:1
             Name: "mid",
-            Reg:  regexp2MustCompile(`^mid:([^\s]*)`),
+            Reg:  regexp.MustCompile(`^mid:([^\s]*)`),
             Format: func(m map[string]string) string {
                 return "mid:%s"
             },
@@ -277,7 +356,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=msid:0c8b064d-d807-43b4-b434-f92a889d8587 98178685-d409-46e0-8e16-7ef0db0db64a
             Name: "msid",
-            Reg:  regexp2MustCompile(`^msid:(.*)`),
+            Reg:  regexp.MustCompile(`^msid:(.*)`),
             Format: func(m map[string]string) string {
                 return "msid:%s"
             },
@@ -285,7 +364,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=ptime:20
             Name: "ptime",
-            Reg:  regexp2MustCompile(`^ptime:(\d*(?:\.\d*)*)`),
+            Reg:  regexp.MustCompile(`^ptime:(\d*(?:\.\d*)*)`),
             Format: func(m map[string]string) string {
                 return "ptime:%d"
             },
@@ -293,7 +372,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=maxptime:60
             Name: "maxptime",
-            Reg:  regexp2MustCompile(`^maxptime:(\d*(?:\.\d*)*)`),
+            Reg:  regexp.MustCompile(`^maxptime:(\d*(?:\.\d*)*)`),
             Format: func(m map[string]string) string {
                 return "maxptime:%d"
             },
@@ -301,17 +380,17 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=sendrecv
             Name: "direction",
-            Reg:  regexp2MustCompile(`^(sendrecv|recvonly|sendonly|inactive)`),
+            Reg:  regexp.MustCompile(`^(sendrecv|recvonly|sendonly|inactive)`),
         },
         {
             // a=ice-lite
             Name: "icelite",
-            Reg:  regexp2MustCompile(`^(ice-lite)`),
+            Reg:  regexp.MustCompile(`^(ice-lite)`),
         },
         {
             // a=ice-ufrag:F7gI
             Name: "iceUfrag",
-            Reg:  regexp2MustCompile(`^ice-ufrag:(\S*)`),
+            Reg:  regexp.MustCompile(`^ice-ufrag:(\S*)`),
             Format: func(m map[string]string) string {
                 return "ice-ufrag:%s"
             },
@@ -319,15 +398,16 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=ice-pwd:x9cml/YzichV2+XlhiMu8g
             Name: "icePwd",
-            Reg:  regexp2MustCompile(`^ice-pwd:(\S*)`),
+            Reg:  regexp.MustCompile(`^ice-pwd:(\S*)`),
             Format: func(m map[string]string) string {
                 return "ice-pwd:%s"
             },
         },
         {
             // a=fingerprint:SHA-1 00:11:22:33:44:55:66:77:88:99:AA:BB:CC:DD:EE:FF:00:11:22:33
-            Name:  "fingerprint",
-            Reg:   regexp2MustCompile(`^fingerprint:(\S*) (\S*)`),
+            // RFC 8122 allows one line per hash function, e.g. during certificate migration
+            Push:  "fingerprints",
+            Reg:   regexp.MustCompile(`^fingerprint:(\S*) (\S*)`),
             Names: []string{"type", "hash"},
             Format: func(m map[string]string) string {
                 return "fingerprint:%s %s"
@@ -340,7 +420,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=candidate:229815620 1 tcp 1518280447 192.168.150.19 60017 typ host tcptype active generation 0 network-id 3 network-cost 10
             // a=candidate:3289912957 2 tcp 1845501695 193.84.77.194 60017 typ srflx raddr 192.168.34.75 rport 60017 tcptype passive generation 0 network-id 3 network-cost 10
             Push:  "candidates",
-            Reg:   regexp2MustCompile(`^candidate:(\S*) (\d*) (\S*) (\d*) (\S*) (\d*) typ (\S*)(?: raddr (\S*) rport (\d*))?(?: tcptype (\S*))?(?: generation (\d*))?(?: network-id (\d*))?(?: network-cost (\d*))?`),
+            Reg:   regexp.MustCompile(`^candidate:(\S*) (\d*) (\S*) (\d*) (\S*) (\d*) typ (\S*)(?: raddr (\S*) rport (\d*))?(?: tcptype (\S*))?(?: generation (\d*))?(?: network-id (\d*))?(?: network-cost (\d*))?`),
             Names: []string{"foundation", "component", "transport", "priority", "ip", "port", "type", "raddr", "rport", "tcptype", "generation", "network-id", "network-cost"},
             Format: func(m map[string]string) string {
                 sb := strings.Builder{}
@@ -381,12 +461,12 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=end-of-candidates (keep after the candidates line for readability)
             Name: "endOfCandidates",
-            Reg:  regexp2MustCompile(`^(end-of-candidates)`),
+            Reg:  regexp.MustCompile(`^(end-of-candidates)`),
         },
         {
             // a=remote-candidates:1 203.0.113.1 54400 2 203.0.113.1 54401 ...
             Name: "remoteCandidates",
-            Reg:  regexp2MustCompile(`^remote-candidates:(.*)`),
+            Reg:  regexp.MustCompile(`^remote-candidates:(.*)`),
             Format: func(m map[string]string) string {
                 return "remote-candidates:%s"
             },
@@ -394,7 +474,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=ice-options:google-ice
             Name: "iceOptions",
-            Reg:  regexp2MustCompile(`^ice-options:(\S*)`),
+            Reg:  regexp.MustCompile(`^ice-options:(\S*)`),
             Format: func(m map[string]string) string {
                 return "ice-options:%s"
             },
@@ -402,7 +482,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=ssrc:2566107569 cname:t9YU8M1UxTF8Y1A1
             Push:  "ssrcs",
-            Reg:   regexp2MustCompile(`^ssrc:(\d*) ([\w_-]*)(?::(.*))?`),
+            Reg:   regexp.MustCompile(`^ssrc:(\d*) ([\w_-]*)(?::(.*))?`),
             Names: []string{"id", "attribute", "value"},
             Format: func(m map[string]string) string {
                 sb := strings.Builder{}
@@ -423,7 +503,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=ssrc-group:FEC-FR 3004364195 1080772241
             Push: "ssrcGroups",
             // token-char = %x21 / %x23-27 / %x2A-2B / %x2D-2E / %x30-39 / %x41-5A / %x5E-7E
-            Reg:   regexp2MustCompile(`^ssrc-group:([\x21\x23\x24\x25\x26\x27\x2A\x2B\x2D\x2E\w]*) (.*)`),
+            Reg:   regexp.MustCompile(`^ssrc-group:([\x21\x23\x24\x25\x26\x27\x2A\x2B\x2D\x2E\w]*) (.*)`),
             Names: []string{"semantics", "ssrcs"},
             Format: func(m map[string]string) string {
                 return "ssrc-group:%s %s"
@@ -432,7 +512,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=msid-semantic: WMS Jvlam5X3SX1OP6pn20zWogvaKJz5Hjf9OnlV
             Name:  "msidSemantic",
-            Reg:   regexp2MustCompile(`^msid-semantic:\s?(\w*) (\S*)`),
+            Reg:   regexp.MustCompile(`^msid-semantic:\s?(\w*) (\S*)`),
             Names: []string{"semantic", "token"},
             Format: func(m map[string]string) string {
                 return "msid-semantic: %s %s" // space after ":" is not accidental
@@ -441,7 +521,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=group:BUNDLE audio video
             Push:  "groups",
-            Reg:   regexp2MustCompile(`^group:(\w*) (.*)`),
+            Reg:   regexp.MustCompile(`^group:(\w*) (.*)`),
             Names: []string{"type", "mids"},
             Format: func(m map[string]string) string {
                 return "group:%s %s"
@@ -450,17 +530,17 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=rtcp-mux
             Name: "rtcpMux",
-            Reg:  regexp2MustCompile(`^(rtcp-mux)`),
+            Reg:  regexp.MustCompile(`^(rtcp-mux)`),
         },
         {
             // a=rtcp-rsize
             Name: "rtcpRsize",
-            Reg:  regexp2MustCompile(`^(rtcp-rsize)`),
+            Reg:  regexp.MustCompile(`^(rtcp-rsize)`),
         },
         {
             // a=sctpmap:5000 webrtc-datachannel 1024
             Name:  "sctpmap",
-            Reg:   regexp2MustCompile(`^sctpmap:([\w_/]*) (\S*)(?: (\S*))?`),
+            Reg:   regexp.MustCompile(`^sctpmap:([\w_/]*) (\S*)(?: (\S*))?`),
             Names: []string{"sctpmapNumber", "app", "maxMessageSize"},
             Format: func(m map[string]string) string {
                 mss := MapStringString(m)
@@ -474,7 +554,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=x-google-flag:conference
             Name: "xGoogleFlag",
-            Reg:  regexp2MustCompile(`^x-google-flag:([^\s]*)`),
+            Reg:  regexp.MustCompile(`^x-google-flag:([^\s]*)`),
             Format: func(m map[string]string) string {
                 return "x-google-flag:%s"
             },
@@ -482,7 +562,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=rid:1 send max-width=1280;max-height=720;max-fps=30;depend=0
             Push:  "rids",
-            Reg:   regexp2MustCompile(`^rid:([\d\w]+) (\w+)(?: ([\S| ]*))?`),
+            Reg:   regexp.MustCompile(`^rid:([\d\w]+) (\w+)(?: ([\S| ]*))?`),
             Names: []string{"id", "direction", "params"},
             Format: func(m map[string]string) string {
                 mss := MapStringString(m)
@@ -498,7 +578,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=imageattr:* send [x=800,y=640] recv *
             // a=imageattr:100 recv [x=320,y=240]
             Push: "imageattrs",
-            Reg: regexp2MustCompile(
+            Reg: regexp.MustCompile(
                 `^imageattr:(\d+|\*)` +
                     `[\s\t]+(send|recv)[\s\t]+(\*|\[\S+\](?:[\s\t]+\[\S+\])*)` +
                     `(?:[\s\t]+(recv|send)[\s\t]+(\*|\[\S+\](?:[\s\t]+\[\S+\])*))?`,
@@ -512,7 +592,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=simulcast:send 1,2,3;~4,~5 recv 6;~7,~8
             // a=simulcast:recv 1;4,5 send 6;7
             Name: "simulcast",
-            Reg: regexp2MustCompile(
+            Reg: regexp.MustCompile(
                 `^simulcast:` +
                     `(send|recv) ([a-zA-Z0-9\-_~;,]+)` +
                     `(?:\s?(send|recv) ([a-zA-Z0-9\-_~;,]+))?` +
@@ -529,7 +609,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=simulcast: recv pt=97;98 send pt=97
             // a=simulcast: send rid=5;6;7 paused=6,7
             Name:  "simulcast_03",
-            Reg:   regexp2MustCompile(`^simulcast:[\s\t]+([\S+\s\t]+)$`),
+            Reg:   regexp.MustCompile(`^simulcast:[\s\t]+([\S+\s\t]+)$`),
             Names: []string{"value"},
             Format: func(m map[string]string) string {
                 return "simulcast: %s"
@@ -539,7 +619,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // a=framerate:25
             // a=framerate:29.97
             Name: "framerate",
-            Reg:  regexp2MustCompile(`^framerate:(\d+(?:$|\.\d+))`),
+            Reg:  regexp.MustCompile(`^framerate:(\d+(?:$|\.\d+))`),
             Format: func(m map[string]string) string {
                 return "framerate:%s"
             },
@@ -548,7 +628,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // RFC4570
             // a=source-filter: incl IN IP4 239.5.2.31 10.1.15.5
             Name:  "sourceFilter",
-            Reg:   regexp2MustCompile(`^source-filter: *(excl|incl) (\S*) (IP4|IP6|\*) (\S*) (.*)`),
+            Reg:   regexp.MustCompile(`^source-filter: *(excl|incl) (\S*) (IP4|IP6|\*) (\S*) (.*)`),
             Names: []string{"filterMode", "netType", "addressTypes", "destAddress", "srcList"},
             Format: func(m map[string]string) string {
                 return "source-filter: %s %s %s %s %s"
@@ -557,12 +637,12 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=bundle-only
             Name: "bundleOnly",
-            Reg:  regexp2MustCompile(`^(bundle-only)`),
+            Reg:  regexp.MustCompile(`^(bundle-only)`),
         },
         {
             // a=label:1
             Name: "label",
-            Reg:  regexp2MustCompile(`^label:(.+)`),
+            Reg:  regexp.MustCompile(`^label:(.+)`),
             Format: func(m map[string]string) string {
                 return "label:%s"
             },
@@ -571,7 +651,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // RFC version 26 for SCTP over DTLS
             // https://tools.ietf.org/html/draft-ietf-mmusic-sctp-sdp-26#section-5
             Name: "sctpPort",
-            Reg:  regexp2MustCompile(`^sctp-port:(\d+)$`),
+            Reg:  regexp.MustCompile(`^sctp-port:(\d+)$`),
             Format: func(m map[string]string) string {
                 return "sctp-port:%s"
             },
@@ -580,7 +660,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // RFC version 26 for SCTP over DTLS
             // https://tools.ietf.org/html/draft-ietf-mmusic-sctp-sdp-26#section-6
             Name: "maxMessageSize",
-            Reg:  regexp2MustCompile(`^max-message-size:(\d+)$`),
+            Reg:  regexp.MustCompile(`^max-message-size:(\d+)$`),
             Format: func(m map[string]string) string {
                 return "max-message-size:%s"
             },
@@ -589,7 +669,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // RFC7273
             // a=ts-refclk:ptp=IEEE1588-2008:39-A7-94-FF-FE-07-CB-D0:37
             Push:  "tsRefClocks",
-            Reg:   regexp2MustCompile(`^ts-refclk:([^\s=]*)(?:=(\S*))?`),
+            Reg:   regexp.MustCompile(`^ts-refclk:([^\s=]*)(?:=(\S*))?`),
             Names: []string{"clksrc", "clksrcExt"},
             Format: func(m map[string]string) string {
                 sb := strings.Builder{}
@@ -606,7 +686,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
             // RFC7273
             // a=mediaclk:direct=963214424
             Name:  "mediaClk",
-            Reg:   regexp2MustCompile(`^mediaclk:(?:id=(\S*))? *([^\s=]*)(?:=(\S*))?(?: *rate=(\d+)\/(\d+))?`),
+            Reg:   regexp.MustCompile(`^mediaclk:(?:id=(\S*))? *([^\s=]*)(?:=(\S*))?(?: *rate=(\d+)\/(\d+))?`),
             Names: []string{"id", "mediaClockName", "mediaClockValue", "rateNumerator", "rateDenominator"},
             Format: func(m map[string]string) string {
                 sb := strings.Builder{}
@@ -620,10 +700,14 @@ var grammarMap GrammarMap = map[string][]*Rule{
 
                 if mss.has("mediaClockValue") {
                     sb.WriteString("=%s")
+                } else {
+                    sb.WriteString("%v")
                 }
 
                 if mss.has("rateNumerator") {
                     sb.WriteString(" rate=%s")
+                } else {
+                    sb.WriteString("%v")
                 }
 
                 if mss.has("rateDenominator") {
@@ -636,7 +720,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=keywds:keywords
             Name: "keywords",
-            Reg:  regexp2MustCompile(`^keywds:(.+)$`),
+            Reg:  regexp.MustCompile(`^keywds:(.+)$`),
             Format: func(m map[string]string) string {
                 return "keywds:%s"
             },
@@ -644,7 +728,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=content:main
             Name: "content",
-            Reg:  regexp2MustCompile(`^content:(.+)`),
+            Reg:  regexp.MustCompile(`^content:(.+)`),
             Format: func(m map[string]string) string {
                 return "content:%s"
             },
@@ -653,7 +737,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=floorctrl:c-s
             Name: "bfcpFloorCtrl",
-            Reg:  regexp2MustCompile(`^floorctrl:(c-only|s-only|c-s)`),
+            Reg:  regexp.MustCompile(`^floorctrl:(c-only|s-only|c-s)`),
             Format: func(m map[string]string) string {
                 return "floorctrl:%s"
             },
@@ -661,7 +745,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=confid:1
             Name: "bfcpConfId",
-            Reg:  regexp2MustCompile(`^confid:(\d+)`),
+            Reg:  regexp.MustCompile(`^confid:(\d+)`),
             Format: func(m map[string]string) string {
                 return "confid:%s"
             },
@@ -669,7 +753,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=userid:1
             Name: "bfcpUserId",
-            Reg:  regexp2MustCompile(`^userid:(\d+)`),
+            Reg:  regexp.MustCompile(`^userid:(\d+)`),
             Format: func(m map[string]string) string {
                 return "userid:%s"
             },
@@ -677,7 +761,7 @@ var grammarMap GrammarMap = map[string][]*Rule{
         {
             // a=floorid:1
             Name:  "bfcpFloorId",
-            Reg:   regexp2MustCompile(`^floorid:(.+) (?:m-stream|mstrm):(.+)`),
+            Reg:   regexp.MustCompile(`^floorid:(.+) (?:m-stream|mstrm):(.+)`),
             Names: []string{"id", "mStream"},
             Format: func(m map[string]string) string {
                 return "floorid:%s mstrm:%s"
@@ -691,17 +775,169 @@ var grammarMap GrammarMap = map[string][]*Rule{
     },
 }
 
+// setDefaults makes a rule without a regexp capture the whole line, and one
+// without a format write its values as they are.
+func (r *Rule) setDefaults() {
+    if r.Reg == nil {
+        r.Reg = regexp.MustCompile(`(.*)`)
+    }
+    if r.Format == nil {
+        r.Format = func(m map[string]string) string {
+            return "%s"
+        }
+    }
+}
+
+// Grammar
+// The rules per line type a Parser or Writer works with. A Grammar is safe for
+// concurrent use: changes replace its rules as a whole, so a parse or write
+// already running keeps the rules it started with.
+type Grammar struct {
+    mu sync.Mutex
+    // rules holds the current GrammarMap.
+    rules atomic.Value
+}
+
+func newGrammar(rules GrammarMap) *Grammar {
+    g := &Grammar{}
+    g.rules.Store(rules)
+    return g
+}
+
+// defaultGrammar is used by the package-level functions and RegisterRule.
+var defaultGrammar *Grammar
+
+// DefaultGrammar returns the grammar used by Parse, Write and the other
+// package-level functions, including the rules added with RegisterRule.
+func DefaultGrammar() *Grammar {
+    return defaultGrammar
+}
+
+func currentGrammar() GrammarMap {
+    return defaultGrammar.snapshot()
+}
+
+func (g *Grammar) snapshot() GrammarMap {
+    return g.rules.Load().(GrammarMap)
+}
+
+// Clone returns an independent copy of the grammar, which can be extended or
+// trimmed without affecting g.
+func (g *Grammar) Clone() *Grammar {
+    current := g.snapshot()
+    rules := make(GrammarMap, len(current))
+    for typ, list := range current {
+        rules[typ] = make([]*Rule, 0, len(list))
+        for _, rule := range list {
+            r := *rule
+            rules[typ] = append(rules[typ], &r)
+        }
+    }
+    return newGrammar(rules)
+}
+
+// update replaces the rules of one line type.
+func (g *Grammar) update(typ string, fn func(rules []*Rule) ([]*Rule, error)) error {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    current := g.snapshot()
+    list, err := fn(current[typ])
+    if err != nil {
+        return err
+    }
+    next := make(GrammarMap, len(current)+1)
+    for t, rules := range current {
+        next[t] = rules
+    }
+    next[typ] = list
+    g.rules.Store(next)
+    return nil
+}
+
+// ErrInvalidRule is returned by RegisterRule for rules it cannot use.
+var ErrInvalidRule = errors.New("invalid grammar rule")
+
+// Register adds a copy of the rule for lines of the given type, e.g. "a". The
+// rule is tried after the other rules of that type but before the catch-all
+// that keeps unmatched attributes in Invalid, and Write formats it in the same
+// place. Values of rules whose name or push target is not a field of the
+// structs end up in Extensions.
+func (g *Grammar) Register(typ string, rule *Rule) error {
+    return g.register(typ, rule, nil)
+}
+
+// register adds the rule after check, if any, has accepted the current rules
+// of the line type.
+func (g *Grammar) register(typ string, rule *Rule, check func(rules []*Rule) error) error {
+    if rule == nil || rule.key() == "" {
+        return fmt.Errorf("%w: a rule needs a name or push target", ErrInvalidRule)
+    }
+    if rule.Parent != "" {
+        return fmt.Errorf("%w: registered rules cannot be nested", ErrInvalidRule)
+    }
+    if !contains(DefaultOuterOrder, typ) && !contains(DefaultInnerOrder, typ) {
+        return fmt.Errorf("%w: unsupported line type %q", ErrInvalidRule, typ)
+    }
+    r := *rule
+    r.setDefaults()
+    r.registered = true
+
+    return g.update(typ, func(rules []*Rule) ([]*Rule, error) {
+        if check != nil {
+            if err := check(rules); err != nil {
+                return nil, err
+            }
+        }
+        at := len(rules)
+        for at > 0 && rules[at-1].Push == "invalid" {
+            at--
+        }
+        return append(append(append(make([]*Rule, 0, len(rules)+1), rules[:at]...), &r), rules[at:]...), nil
+    })
+}
+
+// Remove drops the rules of the given line type that store their result under
+// key, their name or push target; lines they matched are then handled like
+// any other line the grammar does not understand. The m= rule cannot be
+// removed.
+func (g *Grammar) Remove(typ, key string) error {
+    if typ == "m" {
+        return fmt.Errorf("%w: the m= rule cannot be removed", ErrInvalidRule)
+    }
+    return g.update(typ, func(rules []*Rule) ([]*Rule, error) {
+        kept := make([]*Rule, 0, len(rules))
+        for _, rule := range rules {
+            if rule.key() != key {
+                kept = append(kept, rule)
+            }
+        }
+        if len(kept) == len(rules) {
+            return nil, fmt.Errorf("%w: no %s= rule %q", ErrInvalidRule, typ, key)
+        }
+        return kept, nil
+    })
+}
+
+// RegisterRule registers the rule with the default grammar, see
+// Grammar.Register. It is safe to call while other goroutines parse and write.
+func RegisterRule(typ string, rule *Rule) error {
+    return defaultGrammar.Register(typ, rule)
+}
+
+func contains(list []string, s string) bool {
+    for _, el := range list {
+        if el == s {
+            return true
+        }
+    }
+    return false
+}
+
 func init() {
     for _, rules := range grammarMap {
         for _, rule := range rules {
-            if rule.Reg == nil {
-                rule.Reg = regexp2MustCompile(`(.*)`)
-            }
-            if rule.Format == nil {
-                rule.Format = func(m map[string]string) string {
-                    return "%s"
-                }
-            }
+            rule.setDefaults()
         }
     }
+    defaultGrammar = newGrammar(grammarMap)
 }
@@ -0,0 +1,127 @@
+package sdp_transform
+
+import (
+    "errors"
+    "regexp"
+    "sync"
+    "testing"
+)
+
+func TestParserGrammar(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/AVP 0\r\n" +
+        "a=rtcp:54401\r\n" +
+        "a=x-stream:1 main\r\n"
+
+    webrtc := DefaultGrammar().Clone()
+    if err := webrtc.Register("a", &Rule{
+        Push:  "streams",
+        Reg:   regexp.MustCompile(`^x-stream:(\S+) (.*)`),
+        Names: []string{"id", "label"},
+        Format: func(m map[string]string) string {
+            return "x-stream:%s %s"
+        },
+    }); err != nil {
+        t.Fatal(err)
+    }
+    trunk := DefaultGrammar().Clone()
+    if err := trunk.Remove("a", "rtcp"); err != nil {
+        t.Fatal(err)
+    }
+
+    description, err := NewParser(webrtc).Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if streams, _ := description.Media[0].Extensions.List("streams"); len(streams) != 1 || description.Media[0].RTCP == nil {
+        t.Fatalf("unexpected media %+v", description.Media[0])
+    }
+    if out := NewWriter(webrtc).Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+    // attribute access uses the grammar the description was parsed with
+    if values := description.Media[0].GetAttribute("x-stream"); len(values) != 1 || values[0] != "1 main" {
+        t.Fatalf("unexpected x-stream values %q", values)
+    }
+    if err := description.Media[0].AddAttribute("x-stream", "2 backup"); err != nil {
+        t.Fatal(err)
+    }
+    if streams, _ := description.Media[0].Extensions.List("streams"); len(streams) != 2 || description.Media[0].Invalid != nil {
+        t.Fatalf("unexpected media %+v", description.Media[0])
+    }
+
+    // the default grammar is left alone
+    description, err = Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if description.Media[0].Extensions != nil || len(description.Media[0].Invalid) != 1 {
+        t.Fatalf("unexpected media %+v", description.Media[0])
+    }
+
+    description, err = NewParser(trunk).Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if description.Media[0].RTCP != nil || len(description.Media[0].Invalid) != 2 {
+        t.Fatalf("unexpected media %+v", description.Media[0])
+    }
+    if out := NewWriter(trunk).Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+    if err := description.Media[0].SetAttribute("mid", "0"); err != nil {
+        t.Fatal(err)
+    }
+    if description.Media[0].RTCP != nil || len(description.Media[0].Invalid) != 2 {
+        t.Fatalf("removed rule filled in again %+v", description.Media[0])
+    }
+
+    if err := trunk.Remove("a", "rtcp"); !errors.Is(err, ErrInvalidRule) {
+        t.Fatalf("expected ErrInvalidRule, got %v", err)
+    }
+    if err := trunk.Remove("m", ""); !errors.Is(err, ErrInvalidRule) {
+        t.Fatalf("expected ErrInvalidRule, got %v", err)
+    }
+}
+
+func TestGrammarConcurrentUse(t *testing.T) {
+    g := DefaultGrammar().Clone()
+    parser, writer := NewParser(g), NewWriter(g)
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=x-region:eu-west\r\n"
+
+    var wg sync.WaitGroup
+    for i := 0; i < 8; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 50; j++ {
+                description, err := parser.Parse(sdp)
+                if err != nil {
+                    t.Error(err)
+                    return
+                }
+                if out := writer.Write(*description, nil); out != sdp {
+                    t.Errorf("unexpected output:\n%s", out)
+                    return
+                }
+            }
+        }()
+    }
+    if err := g.Register("a", &Rule{
+        Name: "region",
+        Reg:  regexp.MustCompile(`^x-region:(.*)`),
+        Format: func(m map[string]string) string {
+            return "x-region:%s"
+        },
+    }); err != nil {
+        t.Fatal(err)
+    }
+    wg.Wait()
+}
@@ -0,0 +1,219 @@
+package sdp_transform
+
+import "strings"
+
+// layout records the lines of a description as they were parsed, so that Write
+// can reproduce them byte for byte and only rewrite the lines whose values
+// changed since.
+type layout struct {
+    // session first, then one section per media description
+    sections []*layoutSection
+}
+
+type layoutSection struct {
+    lines []*layoutLine
+}
+
+type layoutLine struct {
+    raw    string // line as read, without its line ending
+    ending string
+    // slot the line was parsed into, empty for lines Parse did not keep.
+    slot string
+    // text is the line as the writer produced it right after parsing; a slot
+    // whose written text still matches is unchanged.
+    text string
+}
+
+func (l *layout) section(index int) *layoutSection {
+    for len(l.sections) <= index {
+        l.sections = append(l.sections, &layoutSection{})
+    }
+    return l.sections[index]
+}
+
+// record remembers the text the writer produced for every slot right after
+// parsing. Lines whose slot the writer does not produce, such as fields the
+// struct model dropped, are kept verbatim.
+func (l *layout) record(sections [][]writtenLine) {
+    for i, sec := range l.sections {
+        texts := map[string]string{}
+        if i < len(sections) {
+            for _, line := range sections[i] {
+                texts[line.slot] = line.text
+            }
+        }
+        for _, line := range sec.lines {
+            if line.slot == "" {
+                continue
+            }
+            text, ok := texts[line.slot]
+            if !ok {
+                line.slot = ""
+                continue
+            }
+            line.text = text
+        }
+    }
+}
+
+// write reproduces the recorded lines, replacing the lines whose value changed,
+// dropping those whose value is gone, and inserting new values after the line
+// that precedes them in the writer's order. List elements are told apart by
+// their text rather than their index. A non-empty override replaces the
+// recorded line endings.
+func (l *layout) write(w *countingWriter, sections [][]writtenLine, override string) {
+    ending := "\r\n"
+    if override != "" {
+        ending = override
+    }
+    terminated := true
+    for i, sec := range sections {
+        var recorded *layoutSection
+        if i < len(l.sections) {
+            recorded = l.sections[i]
+        }
+        for _, line := range mergeSection(recorded, sec, ending) {
+            if !terminated {
+                w.WriteString(ending)
+            }
+            w.WriteString(line.raw)
+            terminated = line.ending != ""
+            if terminated && override != "" {
+                w.WriteString(override)
+            } else if terminated {
+                w.WriteString(line.ending)
+                ending = line.ending
+            }
+        }
+    }
+}
+
+func mergeSection(recorded *layoutSection, sec []writtenLine, ending string) []*layoutLine {
+    if recorded == nil {
+        out := make([]*layoutLine, 0, len(sec))
+        for _, line := range sec {
+            out = append(out, &layoutLine{raw: line.text, ending: ending})
+        }
+        return out
+    }
+
+    // single slots are matched by slot; a slot parsed from several lines (the
+    // last one wins) maps to its last line
+    current := map[string]int{}
+    for j, line := range sec {
+        if !isListSlot(line.slot) {
+            current[line.slot] = j
+        }
+    }
+    last := map[string]int{}
+    for i, line := range recorded.lines {
+        if line.slot != "" {
+            last[line.slot] = i
+        }
+    }
+
+    // list elements are matched by their text, so that removing one does not
+    // shift the ones after it onto slots they were not parsed into; what is
+    // left over is an element edited in place
+    matched := map[int]int{}
+    edited := map[int]bool{}
+    pending := map[string][]int{}
+    for i, line := range recorded.lines {
+        if isListSlot(line.slot) {
+            key := listKey(line.slot, line.text)
+            pending[key] = append(pending[key], i)
+        }
+    }
+    claimed := map[int]bool{}
+    for j, line := range sec {
+        key := listKey(line.slot, line.text)
+        if !isListSlot(line.slot) || len(pending[key]) == 0 {
+            continue
+        }
+        matched[pending[key][0]] = j
+        pending[key] = pending[key][1:]
+        claimed[j] = true
+    }
+    unclaimed := map[string]int{}
+    for i, line := range recorded.lines {
+        if _, ok := matched[i]; isListSlot(line.slot) && !ok {
+            unclaimed[line.slot] = i
+        }
+    }
+    for j, line := range sec {
+        if i, ok := unclaimed[line.slot]; ok && isListSlot(line.slot) && !claimed[j] {
+            matched[i] = j
+            edited[i] = true
+            delete(unclaimed, line.slot)
+        }
+    }
+
+    out := make([]*layoutLine, 0, len(recorded.lines))
+    position := map[int]int{}
+    for i, line := range recorded.lines {
+        if line.slot == "" {
+            out = append(out, line)
+            continue
+        }
+        if isListSlot(line.slot) {
+            j, ok := matched[i]
+            switch {
+            case !ok:
+                continue
+            case edited[i]:
+                out = append(out, &layoutLine{raw: sec[j].text, ending: line.ending})
+            default:
+                out = append(out, line)
+            }
+            position[j] = len(out) - 1
+            continue
+        }
+        j, ok := current[line.slot]
+        switch {
+        case !ok:
+            continue
+        case sec[j].text == line.text:
+            out = append(out, line)
+        case last[line.slot] == i:
+            out = append(out, &layoutLine{raw: sec[j].text, ending: line.ending})
+        default:
+            continue
+        }
+        position[j] = len(out) - 1
+    }
+
+    prev := -1
+    for j, line := range sec {
+        if pos, ok := position[j]; ok {
+            prev = pos
+            continue
+        }
+        lineEnding := ending
+        if prev >= 0 && out[prev].ending != "" {
+            lineEnding = out[prev].ending
+        }
+        at := prev + 1
+        out = append(out, nil)
+        copy(out[at+1:], out[at:])
+        out[at] = &layoutLine{raw: line.text, ending: lineEnding}
+        for k, pos := range position {
+            if pos >= at {
+                position[k] = pos + 1
+            }
+        }
+        position[j] = at
+        prev = at
+    }
+    return out
+}
+
+// isListSlot reports slots of list elements, which carry an index.
+func isListSlot(slot string) bool {
+    return strings.Contains(slot, "#")
+}
+
+// listKey identifies a list element by its list and text, leaving out its
+// index.
+func listKey(slot, text string) string {
+    return slot[:strings.LastIndex(slot, "#")+1] + text
+}
@@ -0,0 +1,92 @@
+package sdp_transform
+
+import (
+    "strings"
+    "testing"
+)
+
+const layoutSDP = "v=0\n" +
+    "o=- 20518 0 IN IP4 203.0.113.1\n" +
+    "s=-\n" +
+    "t=0 0\n" +
+    "a=msid-semantic:WMS *\n" +
+    "a=group:BUNDLE 0\n" +
+    "\n" +
+    "m=audio 54400 RTP/SAVPF 0 96\n" +
+    "c=IN IP4 203.0.113.1\n" +
+    "a=mid:0\n" +
+    "a=rtpmap:96 opus/48000/2\n" +
+    "a=setup:actpass\n" +
+    "a=rtpmap:0 PCMU/8000\n" +
+    "a=setup:active\n" +
+    "a=x-vendor:1\n" +
+    "a=candidate:0 1 UDP 2113667327 203.0.113.1 54400 typ host\n" +
+    "a=sendrecv"
+
+func TestPreserveLayout(t *testing.T) {
+    description, err := ParseWithOptions(layoutSDP, ParseOptions{PreserveLayout: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if out := Write(*description, nil); out != layoutSDP {
+        t.Fatalf("round trip changed the description:\n%q", out)
+    }
+
+    media := description.Media[0]
+    media.MID = nil
+    media.RTP[1].Codec = "PCMA"
+    media.Candidates = append(media.Candidates, &Candidate{
+        Foundation: "1", Component: "1", Transport: "UDP", Priority: "1694498815",
+        IP: "192.0.2.1", Port: "54401", Type: "srflx",
+    })
+    out := Write(*description, nil)
+    expected := strings.NewReplacer(
+        "a=mid:0\n", "",
+        "a=rtpmap:0 PCMU/8000\n", "a=rtpmap:0 PCMA/8000\n",
+        "typ host\n", "typ host\na=candidate:1 1 UDP 1694498815 192.0.2.1 54401 typ srflx\n",
+    ).Replace(layoutSDP)
+    if out != expected {
+        t.Fatalf("unexpected output:\n%q\nexpected:\n%q", out, expected)
+    }
+
+    media.Setup = nil
+    if out = Write(*description, nil); strings.Contains(out, "setup") {
+        t.Fatalf("removed attribute still written:\n%q", out)
+    }
+}
+
+func TestPreserveLayoutDeletion(t *testing.T) {
+    // the trailing space of the PCMA line is not what the writer would produce
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/AVP 0 8 96\r\n" +
+        "a=rtpmap:0 PCMU/8000\r\n" +
+        "a=rtpmap:8 PCMA/8000 \r\n" +
+        "a=rtpmap:96 opus/48000/2\r\n" +
+        "a=candidate:0 1 UDP 2113667327 203.0.113.1 54400 typ host\r\n" +
+        "a=candidate:1 1 UDP 1694498815 192.0.2.1 54401 typ srflx\r\n"
+
+    description, err := ParseWithOptions(sdp, ParseOptions{PreserveLayout: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    media := description.Media[0]
+    media.RTP = media.RTP[1:]
+    media.Candidates = media.Candidates[1:]
+    expected := strings.NewReplacer(
+        "a=rtpmap:0 PCMU/8000\r\n", "",
+        "a=candidate:0 1 UDP 2113667327 203.0.113.1 54400 typ host\r\n", "",
+    ).Replace(sdp)
+    if out := Write(*description, nil); out != expected {
+        t.Fatalf("unexpected output:\n%q\nexpected:\n%q", out, expected)
+    }
+
+    // an element edited after a deletion is rewritten where it was
+    media.RTP[1].Codec = "OPUS"
+    expected = strings.Replace(expected, "opus", "OPUS", 1)
+    if out := Write(*description, nil); out != expected {
+        t.Fatalf("unexpected output:\n%q\nexpected:\n%q", out, expected)
+    }
+}
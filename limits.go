@@ -0,0 +1,97 @@
+package sdp_transform
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// ErrLimitExceeded matches every LimitError.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// LimitError
+// Reports input that goes over one of the ParseOptions limits. Parse returns
+// it wrapped in a *ParseError that locates the offending line.
+type LimitError struct {
+    Limit string // name of the ParseOptions field, e.g. "MaxLineLength"
+    Max   int64  // value of the limit; nanoseconds for LineTimeout
+}
+
+func (e *LimitError) Error() string {
+    if e.Limit == "LineTimeout" {
+        return fmt.Sprintf("%s of %v exceeded", e.Limit, time.Duration(e.Max))
+    }
+    return fmt.Sprintf("%s of %d exceeded", e.Limit, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+    return target == ErrLimitExceeded
+}
+
+// limiter enforces the ParseOptions limits while a description is decoded.
+type limiter struct {
+    options    ParseOptions
+    size       int
+    lines      int
+    media      int
+    attributes int
+}
+
+// scanBuffer returns the largest line, ending included, the scanner should
+// buffer, and the limit that a longer line exceeds.
+func (l *limiter) scanBuffer() (int, *LimitError) {
+    max, limit := bufio.MaxScanTokenSize, (*LimitError)(nil)
+    if o := l.options; o.MaxLineLength > 0 {
+        // room for the line ending
+        max, limit = o.MaxLineLength+2, &LimitError{Limit: "MaxLineLength", Max: int64(o.MaxLineLength)}
+    }
+    if o := l.options; o.MaxSize > 0 && o.MaxSize < max {
+        max, limit = o.MaxSize+1, &LimitError{Limit: "MaxSize", Max: int64(o.MaxSize)}
+    }
+    return max, limit
+}
+
+// line accounts for a line read from the input; token includes the line
+// ending, line does not.
+func (l *limiter) line(token, line string) error {
+    o := l.options
+    l.size += len(token)
+    l.lines++
+    switch {
+    case o.MaxSize > 0 && l.size > o.MaxSize:
+        return &LimitError{Limit: "MaxSize", Max: int64(o.MaxSize)}
+    case o.MaxLines > 0 && l.lines > o.MaxLines:
+        return &LimitError{Limit: "MaxLines", Max: int64(o.MaxLines)}
+    case o.MaxLineLength > 0 && len(line) > o.MaxLineLength:
+        return &LimitError{Limit: "MaxLineLength", Max: int64(o.MaxLineLength)}
+    }
+    return nil
+}
+
+// typ accounts for a line of the given type.
+func (l *limiter) typ(typ string) error {
+    o := l.options
+    switch typ {
+    case "m":
+        l.media++
+        l.attributes = 0
+        if o.MaxMediaSections > 0 && l.media > o.MaxMediaSections {
+            return &LimitError{Limit: "MaxMediaSections", Max: int64(o.MaxMediaSections)}
+        }
+    case "a":
+        l.attributes++
+        if o.MaxAttributes > 0 && l.attributes > o.MaxAttributes {
+            return &LimitError{Limit: "MaxAttributes", Max: int64(o.MaxAttributes)}
+        }
+    }
+    return nil
+}
+
+// matched checks how long matching a line took.
+func (l *limiter) matched(start time.Time) error {
+    if o := l.options; o.LineTimeout > 0 && time.Since(start) > o.LineTimeout {
+        return &LimitError{Limit: "LineTimeout", Max: int64(o.LineTimeout)}
+    }
+    return nil
+}
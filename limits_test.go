@@ -0,0 +1,69 @@
+package sdp_transform
+
+import (
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseLimits(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=group:BUNDLE 0 1\r\n" +
+        "m=audio 54400 RTP/SAVPF 0\r\n" +
+        "a=mid:0\r\n" +
+        "a=rtpmap:0 PCMU/8000\r\n" +
+        "m=video 55400 RTP/SAVPF 97\r\n" +
+        "a=mid:1\r\n"
+
+    tests := []struct {
+        name    string
+        options ParseOptions
+        limit   string
+        line    int
+    }{
+        {"size", ParseOptions{MaxSize: 100}, "MaxSize", 7},
+        {"line length", ParseOptions{MaxLineLength: 29}, "MaxLineLength", 2},
+        {"lines", ParseOptions{MaxLines: 9}, "MaxLines", 10},
+        {"media sections", ParseOptions{MaxMediaSections: 1}, "MaxMediaSections", 9},
+        {"attributes", ParseOptions{MaxAttributes: 1}, "MaxAttributes", 8},
+        {"line timeout", ParseOptions{LineTimeout: time.Nanosecond}, "LineTimeout", 1},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            _, err := ParseWithOptions(sdp, tt.options)
+            var parseErr *ParseError
+            var limitErr *LimitError
+            if !errors.As(err, &parseErr) || !errors.As(err, &limitErr) || !errors.Is(err, ErrLimitExceeded) {
+                t.Fatalf("expected a limit error, got %v", err)
+            }
+            if limitErr.Limit != tt.limit || parseErr.Line != tt.line {
+                t.Fatalf("unexpected limit %s at line %d", limitErr.Limit, parseErr.Line)
+            }
+        })
+    }
+
+    within := ParseOptions{MaxSize: len(sdp), MaxLineLength: 30, MaxLines: 10, MaxMediaSections: 2, MaxAttributes: 2, LineTimeout: time.Second}
+    if _, err := ParseWithOptions(sdp, within); err != nil {
+        t.Fatalf("unexpected error within limits: %v", err)
+    }
+}
+
+func TestParseLineLengthBeyondScanBuffer(t *testing.T) {
+    long := "a=fmtp:0 " + strings.Repeat("x", 100000) + "\r\n"
+    sdp := "v=0\r\no=- 1 1 IN IP4 203.0.113.1\r\ns=-\r\nt=0 0\r\nm=audio 9 RTP/AVP 0\r\n" + long
+
+    if _, err := ParseWithOptions(sdp, ParseOptions{MaxLineLength: 200000}); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    _, err := ParseWithOptions(sdp, ParseOptions{MaxLineLength: 1000})
+    var parseErr *ParseError
+    var limitErr *LimitError
+    if !errors.As(err, &parseErr) || !errors.As(err, &limitErr) || limitErr.Limit != "MaxLineLength" || parseErr.Line != 6 {
+        t.Fatalf("expected MaxLineLength at line 6, got %v", err)
+    }
+}
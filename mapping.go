@@ -0,0 +1,316 @@
+package sdp_transform
+
+import (
+    "errors"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+)
+
+// The parser stores the values a rule captured straight into the fields of the
+// struct model, found by the json tags matching the rule's name, push target
+// and names, and the writer formats lines from the same fields. Extensions
+// move their values in and out of maps keyed the same way.
+
+// fieldError reports a value whose shape does not fit the struct field that
+// its key maps to.
+type fieldError struct {
+    field string
+    value interface{}
+    typ   reflect.Type
+}
+
+func (e *fieldError) Error() string {
+    return fmt.Sprintf("cannot assign %s to field %s of type %s", describeValue(e.value), e.field, e.typ)
+}
+
+// errNoField is returned by assignValues for rules the struct has no field
+// for.
+var errNoField = errors.New("no field for rule")
+
+// assignValues stores the values a rule captured in the struct v, laid out the
+// way the rule's shape says: a new list element for push rules, a nested
+// struct for named rules with names, a string for other named rules, and the
+// fields of v itself for rules without a name. It returns the index of the new
+// list element, or -1, and the names the struct has no field for.
+func assignValues(rule *Rule, v reflect.Value, values map[string]string) (int, []string, error) {
+    switch {
+    case rule.Push != "":
+        field, ok := structField(v, rule.Push)
+        if !ok {
+            return 0, nil, errNoField
+        }
+        t := field.Type()
+        mismatch := &fieldError{field: rule.Push, value: []map[string]interface{}{}, typ: t}
+        if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Ptr || t.Elem().Elem().Kind() != reflect.Struct {
+            return 0, nil, mismatch
+        }
+        el := reflect.New(t.Elem().Elem())
+        missing, err := setFields(el.Elem(), values)
+        if err != nil {
+            return 0, nil, mismatch
+        }
+        field.Set(reflect.Append(field, el))
+        return field.Len() - 1, missing, nil
+    case rule.Name != "" && len(rule.Names) != 0:
+        field, ok := structField(v, rule.Name)
+        if !ok {
+            return 0, nil, errNoField
+        }
+        t := field.Type()
+        mismatch := &fieldError{field: rule.Name, value: map[string]interface{}{}, typ: t}
+        if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+            return 0, nil, mismatch
+        }
+        if field.IsNil() {
+            field.Set(reflect.New(t.Elem()))
+        }
+        missing, err := setFields(field.Elem(), values)
+        if err != nil {
+            return 0, nil, mismatch
+        }
+        return -1, missing, nil
+    case rule.Name != "":
+        field, ok := structField(v, rule.Name)
+        if !ok {
+            return 0, nil, errNoField
+        }
+        if !setString(field, values[rule.Name]) {
+            return 0, nil, &fieldError{field: rule.Name, value: values[rule.Name], typ: field.Type()}
+        }
+        return -1, nil, nil
+    }
+    missing, err := setFields(v, values)
+    return -1, missing, err
+}
+
+// setFields stores every value in the field of v with its name and returns
+// the names v has no field for, sorted. A field that cannot hold a string is
+// reported as a *fieldError.
+func setFields(v reflect.Value, values map[string]string) ([]string, error) {
+    var missing []string
+    for name, value := range values {
+        field, ok := structField(v, name)
+        if !ok {
+            missing = append(missing, name)
+            continue
+        }
+        if !setString(field, value) {
+            return nil, &fieldError{field: name, value: value, typ: field.Type()}
+        }
+    }
+    sort.Strings(missing)
+    return missing, nil
+}
+
+// structField returns the field of the struct v with the given json name.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+    field, ok := jsonFields(v.Type())[name]
+    if !ok {
+        return reflect.Value{}, false
+    }
+    return v.FieldByIndex(field.Index), true
+}
+
+// setString stores s in a string, *string or interface{} field.
+func setString(v reflect.Value, s string) bool {
+    switch {
+    case v.Kind() == reflect.String:
+        v.SetString(s)
+    case v.Kind() == reflect.Ptr && v.Type().Elem().Kind() == reflect.String:
+        v.Set(reflect.ValueOf(&s))
+    case v.Kind() == reflect.Interface && v.NumMethod() == 0:
+        v.Set(reflect.ValueOf(s))
+    default:
+        return false
+    }
+    return true
+}
+
+// setField returns the field of the struct v with the given json name when it
+// holds a value: a non-nil pointer, slice or interface, or a string unless it
+// is empty and tagged omitempty.
+func setField(v reflect.Value, name string) (reflect.Value, bool) {
+    field, ok := jsonFields(v.Type())[name]
+    if !ok {
+        return reflect.Value{}, false
+    }
+    fv := v.FieldByIndex(field.Index)
+    switch fv.Kind() {
+    case reflect.String:
+        return fv, fv.Len() != 0 || !strings.Contains(field.Tag.Get("json"), ",omitempty")
+    case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+        return fv, !fv.IsNil()
+    }
+    return fv, true
+}
+
+// fieldString returns the text of the string, *string or interface{} field of
+// v with the given json name, and whether it holds a value.
+func fieldString(v reflect.Value, name string) (string, bool, error) {
+    fv, ok := setField(v, name)
+    if !ok {
+        return "", false, nil
+    }
+    switch {
+    case fv.Kind() == reflect.String:
+        return fv.String(), true, nil
+    case fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.String:
+        return fv.Elem().String(), true, nil
+    case fv.Kind() == reflect.Interface:
+        s, err := lineValue(fv.Interface())
+        return s, true, err
+    }
+    return "", true, fmt.Errorf("%w: %s", ErrUnsupportedValue, fv.Type())
+}
+
+func describeValue(v interface{}) string {
+    switch v.(type) {
+    case string:
+        return "string"
+    case map[string]interface{}:
+        return "object"
+    case []map[string]interface{}, []interface{}:
+        return "list"
+    }
+    return fmt.Sprintf("%T", v)
+}
+
+// decodeStruct fills the struct v from values. Keys without a
+// matching field are ignored; a value of the wrong shape is returned as a
+// *fieldError naming the top-level key.
+func decodeStruct(values map[string]interface{}, v reflect.Value) error {
+    fields := jsonFields(v.Type())
+    for key, value := range values {
+        field, ok := fields[key]
+        if !ok {
+            continue
+        }
+        if !decodeValue(value, v.FieldByIndex(field.Index)) {
+            return &fieldError{field: key, value: value, typ: field.Type}
+        }
+    }
+    return nil
+}
+
+func decodeValue(value interface{}, v reflect.Value) bool {
+    if value == nil {
+        return true
+    }
+    t := v.Type()
+    switch {
+    case t.Kind() == reflect.String:
+        s, ok := value.(string)
+        if ok {
+            v.SetString(s)
+        }
+        return ok
+    case t.Kind() == reflect.Interface:
+        v.Set(reflect.ValueOf(value))
+        return true
+    case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.String:
+        s, ok := value.(string)
+        if ok {
+            v.Set(reflect.ValueOf(&s))
+        }
+        return ok
+    case t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct:
+        m, ok := value.(map[string]interface{})
+        if !ok {
+            return false
+        }
+        el := reflect.New(t.Elem())
+        if decodeStruct(m, el.Elem()) != nil {
+            return false
+        }
+        v.Set(el)
+        return true
+    case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Ptr && t.Elem().Elem().Kind() == reflect.Struct:
+        list, ok := value.([]map[string]interface{})
+        if !ok {
+            return false
+        }
+        slice := reflect.MakeSlice(t, len(list), len(list))
+        for i, m := range list {
+            el := reflect.New(t.Elem().Elem())
+            if decodeStruct(m, el.Elem()) != nil {
+                return false
+            }
+            slice.Index(i).Set(el)
+        }
+        v.Set(slice)
+        return true
+    }
+    return false
+}
+
+// encodeStruct returns the values of the struct v, keyed by json tag. Nil
+// pointers and slices, and empty strings tagged omitempty, are left out;
+// nested structs become maps and slices of structs lists of maps. A nil
+// element in such a list is reported as a *WriteError.
+func encodeStruct(v reflect.Value) (map[string]interface{}, error) {
+    fields := jsonFields(v.Type())
+    values := make(map[string]interface{}, len(fields))
+    for key, field := range fields {
+        value, ok, err := encodeValue(v.FieldByIndex(field.Index), field)
+        if err != nil {
+            var writeErr *WriteError
+            if !errors.As(err, &writeErr) {
+                err = &WriteError{Field: key, Err: err}
+            }
+            return nil, err
+        }
+        if ok {
+            values[key] = value
+        }
+    }
+    return values, nil
+}
+
+func encodeValue(v reflect.Value, field reflect.StructField) (interface{}, bool, error) {
+    switch v.Kind() {
+    case reflect.String:
+        if v.Len() == 0 && strings.Contains(field.Tag.Get("json"), ",omitempty") {
+            return nil, false, nil
+        }
+        return v.String(), true, nil
+    case reflect.Interface:
+        if v.IsNil() {
+            return nil, false, nil
+        }
+        return v.Interface(), true, nil
+    case reflect.Ptr:
+        if v.IsNil() {
+            return nil, false, nil
+        }
+        switch v.Elem().Kind() {
+        case reflect.String:
+            return v.Elem().String(), true, nil
+        case reflect.Struct:
+            m, err := encodeStruct(v.Elem())
+            return m, err == nil, err
+        }
+    case reflect.Slice:
+        if v.IsNil() {
+            return nil, false, nil
+        }
+        list := make([]interface{}, 0, v.Len())
+        for i := 0; i < v.Len(); i++ {
+            el := v.Index(i)
+            if el.Kind() != reflect.Ptr || el.Type().Elem().Kind() != reflect.Struct {
+                continue
+            }
+            if el.IsNil() {
+                return nil, false, fmt.Errorf("%w: nil element %d", ErrUnsupportedValue, i)
+            }
+            m, err := encodeStruct(el.Elem())
+            if err != nil {
+                return nil, false, err
+            }
+            list = append(list, m)
+        }
+        return list, true, nil
+    }
+    return nil, false, nil
+}
@@ -0,0 +1,691 @@
+package sdp_transform
+
+import (
+    "bytes"
+    "fmt"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Unmarshal and Marshal map descriptions to structs of your own through sdp
+// struct tags, in the spirit of encoding/json:
+//
+//   - `sdp:"s="` selects the s= line and `sdp:"a=mid"` the a=mid attribute;
+//   - `sdp:"media[video].a=rtpmap"` selects the line in the media descriptions
+//     of type video, media[0] in the first media description and media[*] in
+//     all of them;
+//   - a media selector alone, such as `sdp:"media[video]"`, maps a struct or a
+//     slice of structs to whole media descriptions, their fields carrying tags
+//     of their own.
+//
+// A bool field reports whether the attribute is present. A string or number
+// field holds the text after "<type>=", or after "a=<name>:" for attributes,
+// and a slice of them every matching line. A struct field is filled from the
+// values the grammar rule of the line captured, its fields tagged with the
+// value names, e.g. `sdp:"payload"` and `sdp:"codec"` for a=rtpmap.
+
+// sdpTag is a parsed sdp struct tag.
+type sdpTag struct {
+    media    bool
+    selector string // media type, index or "*"
+    typ      string // line type, "" when the tag selects media descriptions
+    name     string // attribute name of a= tags
+}
+
+func parseTag(tag string) (sdpTag, error) {
+    var t sdpTag
+    invalid := fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+    rest := tag
+    if strings.HasPrefix(rest, "media[") {
+        end := strings.Index(rest, "]")
+        if end < 0 {
+            return t, invalid
+        }
+        t.media, t.selector = true, rest[len("media["):end]
+        rest = rest[end+1:]
+        if t.selector == "" {
+            return t, invalid
+        }
+        if rest == "" {
+            return t, nil
+        }
+        if !strings.HasPrefix(rest, ".") {
+            return t, invalid
+        }
+        rest = rest[1:]
+    }
+    typ, name, ok := strings.Cut(rest, "=")
+    if !ok || len(typ) != 1 || typ[0] < 'a' || typ[0] > 'z' || (typ == "a") != (name != "") {
+        return t, invalid
+    }
+    t.typ, t.name = typ, name
+    return t, nil
+}
+
+// fieldTag returns the parsed sdp tag of a struct field, false for fields
+// without one.
+func fieldTag(field reflect.StructField) (sdpTag, bool, error) {
+    s, ok := field.Tag.Lookup("sdp")
+    if !ok || s == "-" || field.PkgPath != "" {
+        return sdpTag{}, false, nil
+    }
+    tag, err := parseTag(s)
+    if err != nil {
+        return tag, false, fmt.Errorf("%w on field %s", err, field.Name)
+    }
+    return tag, true, nil
+}
+
+// structType returns the struct type of a struct or struct pointer type.
+func structType(t reflect.Type) (reflect.Type, bool) {
+    if t.Kind() == reflect.Ptr {
+        t = t.Elem()
+    }
+    return t, t.Kind() == reflect.Struct
+}
+
+// taggedLine is a line as seen by Unmarshal.
+type taggedLine struct {
+    line  int
+    typ   string
+    name  string // attribute name of a= lines
+    value string // text after "<type>=", or after "a=<name>:"
+    // values holds what the grammar rule captured, nil for unknown lines.
+    values map[string]string
+}
+
+// taggedSection holds the lines of the session or of one media description.
+type taggedSection struct {
+    media string // media type, "" at session level
+    lines []taggedLine
+}
+
+// Unmarshal fills the tagged fields of the struct v points to from the
+// description, tokenizing its lines with the grammar like Parse.
+func Unmarshal(data []byte, v interface{}) error {
+    return NewParser(defaultGrammar).Unmarshal(data, v)
+}
+
+// Unmarshal is the package-level Unmarshal with the parser's grammar.
+func (p *Parser) Unmarshal(data []byte, v interface{}) error {
+    rv := reflect.ValueOf(v)
+    if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+        return fmt.Errorf("%w: cannot unmarshal into %T", ErrInvalidTag, v)
+    }
+
+    sections := []*taggedSection{{}}
+    err := p.NewDecoder(bytes.NewReader(data), ParseOptions{}).Decode(func(ev *Event) error {
+        if ev.Type == "" {
+            return nil
+        }
+        if ev.Kind == EventMediaStart {
+            sections = append(sections, &taggedSection{media: ev.Values["type"]})
+        }
+        _, content, _ := strings.Cut(ev.Raw, "=")
+        l := taggedLine{line: ev.Line, typ: ev.Type, value: content}
+        if ev.Kind != EventUnknownLine {
+            l.values = ev.Values
+        }
+        if ev.Type == "a" {
+            l.name, l.value, _ = strings.Cut(content, ":")
+        }
+        sec := sections[len(sections)-1]
+        sec.lines = append(sec.lines, l)
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    return unmarshalTagged(sections[0], sections[1:], true, rv.Elem())
+}
+
+// unmarshalTagged fills the tagged fields of v from the section. Media
+// selectors are only allowed at the top level.
+func unmarshalTagged(sec *taggedSection, media []*taggedSection, top bool, v reflect.Value) error {
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        tag, ok, err := fieldTag(field)
+        if err != nil {
+            return err
+        }
+        if !ok {
+            continue
+        }
+        sections := []*taggedSection{sec}
+        if tag.media {
+            if !top {
+                return fmt.Errorf("%w: media selector on field %s inside a media description", ErrInvalidTag, field.Name)
+            }
+            sections = selectMedia(media, tag.selector)
+        }
+        if tag.typ == "" {
+            if err := unmarshalMedia(sections, v.Field(i), field); err != nil {
+                return err
+            }
+            continue
+        }
+        var lines []taggedLine
+        for _, sec := range sections {
+            for _, l := range sec.lines {
+                if l.typ == tag.typ && l.name == tag.name {
+                    lines = append(lines, l)
+                }
+            }
+        }
+        if err := unmarshalLines(lines, v.Field(i)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func selectMedia(media []*taggedSection, selector string) []*taggedSection {
+    if selector == "*" {
+        return media
+    }
+    if i, err := strconv.Atoi(selector); err == nil {
+        if i < 0 || i >= len(media) {
+            return nil
+        }
+        return media[i : i+1]
+    }
+    var selected []*taggedSection
+    for _, sec := range media {
+        if sec.media == selector {
+            selected = append(selected, sec)
+        }
+    }
+    return selected
+}
+
+// unmarshalMedia fills a struct, struct pointer or slice of them with whole
+// media descriptions.
+func unmarshalMedia(sections []*taggedSection, v reflect.Value, field reflect.StructField) error {
+    t := v.Type()
+    if st, ok := structType(t); ok {
+        if len(sections) == 0 {
+            return nil
+        }
+        el := reflect.New(st)
+        if err := unmarshalTagged(sections[0], nil, false, el.Elem()); err != nil {
+            return err
+        }
+        if t.Kind() == reflect.Ptr {
+            v.Set(el)
+        } else {
+            v.Set(el.Elem())
+        }
+        return nil
+    }
+    if t.Kind() != reflect.Slice {
+        return fmt.Errorf("%w: field %s of type %s cannot hold a media description", ErrInvalidTag, field.Name, t)
+    }
+    st, ok := structType(t.Elem())
+    if !ok {
+        return fmt.Errorf("%w: field %s of type %s cannot hold a media description", ErrInvalidTag, field.Name, t)
+    }
+    slice := reflect.MakeSlice(t, 0, len(sections))
+    for _, sec := range sections {
+        el := reflect.New(st)
+        if err := unmarshalTagged(sec, nil, false, el.Elem()); err != nil {
+            return err
+        }
+        if t.Elem().Kind() == reflect.Ptr {
+            slice = reflect.Append(slice, el)
+        } else {
+            slice = reflect.Append(slice, el.Elem())
+        }
+    }
+    v.Set(slice)
+    return nil
+}
+
+// unmarshalLines fills v with the first of the lines, or every line for a
+// slice; a bool reports whether there is any.
+func unmarshalLines(lines []taggedLine, v reflect.Value) error {
+    switch v.Kind() {
+    case reflect.Bool:
+        v.SetBool(len(lines) != 0)
+        return nil
+    case reflect.Slice:
+        slice := reflect.MakeSlice(v.Type(), len(lines), len(lines))
+        for i, l := range lines {
+            if err := unmarshalLine(l, slice.Index(i)); err != nil {
+                return err
+            }
+        }
+        v.Set(slice)
+        return nil
+    }
+    if len(lines) == 0 {
+        return nil
+    }
+    return unmarshalLine(lines[0], v)
+}
+
+func unmarshalLine(l taggedLine, v reflect.Value) error {
+    t := v.Type()
+    if t.Kind() == reflect.Ptr {
+        el := reflect.New(t.Elem())
+        if err := unmarshalLine(l, el.Elem()); err != nil {
+            return err
+        }
+        v.Set(el)
+        return nil
+    }
+    if t.Kind() != reflect.Struct {
+        if err := setScalar(v, l.value); err != nil {
+            return lineError(l, l.name, l.value, err)
+        }
+        return nil
+    }
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        name, ok := field.Tag.Lookup("sdp")
+        if !ok || name == "-" || field.PkgPath != "" {
+            continue
+        }
+        value, ok := l.values[name]
+        if !ok {
+            continue
+        }
+        if err := setScalar(v.Field(i), value); err != nil {
+            return lineError(l, name, value, err)
+        }
+    }
+    return nil
+}
+
+func lineError(l taggedLine, field, value string, err error) error {
+    parseErr := numberError(field, value, err)
+    parseErr.Line, parseErr.Type = l.line, l.typ
+    return parseErr
+}
+
+// setScalar stores the text of a value in a string or number.
+func setScalar(v reflect.Value, s string) error {
+    switch v.Kind() {
+    case reflect.Ptr:
+        el := reflect.New(v.Type().Elem())
+        if err := setScalar(el.Elem(), s); err != nil {
+            return err
+        }
+        v.Set(el)
+    case reflect.String:
+        v.SetString(s)
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+        if err != nil {
+            return err
+        }
+        v.SetInt(n)
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+        if err != nil {
+            return err
+        }
+        v.SetUint(n)
+    case reflect.Float32, reflect.Float64:
+        n, err := strconv.ParseFloat(s, v.Type().Bits())
+        if err != nil {
+            return err
+        }
+        v.SetFloat(n)
+    default:
+        return fmt.Errorf("%w: cannot store a value in %s", ErrInvalidTag, v.Type())
+    }
+    return nil
+}
+
+// scalarText is the counterpart of setScalar.
+func scalarText(v reflect.Value) (string, error) {
+    switch v.Kind() {
+    case reflect.String:
+        return v.String(), nil
+    case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+        return strconv.FormatInt(v.Int(), 10), nil
+    case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+        return strconv.FormatUint(v.Uint(), 10), nil
+    case reflect.Float32, reflect.Float64:
+        return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+    }
+    return "", fmt.Errorf("%w: cannot write a value of type %s", ErrInvalidTag, v.Type())
+}
+
+// outputSection collects the lines Marshal writes for the session or one
+// media description.
+type outputSection struct {
+    selector string // media selector that created the section
+    media    string // media type, from its m= line
+    // grouped marks sections filled from a struct tagged with a media
+    // selector alone.
+    grouped bool
+    lines   []typedLine
+}
+
+type typedLine struct {
+    typ, text string
+}
+
+// write writes the lines sorted by type in the given order; types outside the
+// order go with the attributes.
+func (sec *outputSection) write(buf *bytes.Buffer, order []string) {
+    rank := func(typ string) int {
+        for i, t := range order {
+            if t == typ {
+                return i
+            }
+        }
+        for i, t := range order {
+            if t == "a" {
+                return i
+            }
+        }
+        return len(order)
+    }
+    sort.SliceStable(sec.lines, func(i, j int) bool {
+        return rank(sec.lines[i].typ) < rank(sec.lines[j].typ)
+    })
+    for _, l := range sec.lines {
+        buf.WriteString(l.text)
+        buf.WriteString(string(LineEndingCRLF))
+    }
+}
+
+// marshaller builds the sections of a description from tagged fields.
+type marshaller struct {
+    grammar GrammarMap
+    session *outputSection
+    media   []*outputSection
+}
+
+// Marshal writes the tagged fields of v, a struct or struct pointer, as a
+// description; see Unmarshal for the tags. Only tagged lines are written, so
+// v needs v=, o=, s= and t= fields for a complete session description, and
+// every media description an m= field. media[*] fields are written to every
+// media description the other fields add, wherever they are declared. Zero
+// numbers and empty strings are left out; use a pointer to write them.
+func Marshal(v interface{}) ([]byte, error) {
+    return NewWriter(defaultGrammar).Marshal(v)
+}
+
+// Marshal is the package-level Marshal with the writer's grammar.
+func (wr *Writer) Marshal(v interface{}) ([]byte, error) {
+    rv := reflect.ValueOf(v)
+    for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+        rv = rv.Elem()
+    }
+    if rv.Kind() != reflect.Struct {
+        return nil, fmt.Errorf("%w: cannot marshal %T", ErrInvalidTag, v)
+    }
+    m := &marshaller{grammar: wr.grammar.snapshot(), session: &outputSection{}}
+    if err := m.marshalTagged(m.session, true, rv); err != nil {
+        return nil, err
+    }
+
+    buf := &bytes.Buffer{}
+    m.session.write(buf, DefaultOuterOrder)
+    for _, sec := range m.media {
+        if sec.media == "" {
+            return nil, &WriteError{Type: "m", Err: fmt.Errorf("%w: media[%s] has no m= line", ErrInvalidTag, sec.selector)}
+        }
+        sec.write(buf, append([]string{"m"}, DefaultInnerOrder...))
+    }
+    return buf.Bytes(), nil
+}
+
+// sections returns the media descriptions a selector addresses, adding one
+// for a new media type or the next index.
+func (m *marshaller) sections(selector string) ([]*outputSection, error) {
+    if selector == "*" {
+        return m.media, nil
+    }
+    if i, err := strconv.Atoi(selector); err == nil {
+        if i >= 0 && i < len(m.media) {
+            return m.media[i : i+1], nil
+        }
+        if i != len(m.media) {
+            return nil, fmt.Errorf("%w: media[%d] skips media descriptions", ErrInvalidTag, i)
+        }
+        return []*outputSection{m.newSection(selector)}, nil
+    }
+    for _, sec := range m.media {
+        if sec.media == selector || sec.selector == selector {
+            return []*outputSection{sec}, nil
+        }
+    }
+    return []*outputSection{m.newSection(selector)}, nil
+}
+
+// groupSection returns the media description for the next struct of a media
+// selector: the one an index addresses, or else the first of the type no
+// struct filled yet.
+func (m *marshaller) groupSection(selector string) (*outputSection, error) {
+    if _, err := strconv.Atoi(selector); err == nil {
+        sections, err := m.sections(selector)
+        if err != nil {
+            return nil, err
+        }
+        sections[0].grouped = true
+        return sections[0], nil
+    }
+    for _, sec := range m.media {
+        if (sec.media == selector || sec.selector == selector) && !sec.grouped {
+            sec.grouped = true
+            return sec, nil
+        }
+    }
+    sec := m.newSection(selector)
+    sec.grouped = true
+    return sec, nil
+}
+
+func (m *marshaller) newSection(selector string) *outputSection {
+    sec := &outputSection{selector: selector}
+    m.media = append(m.media, sec)
+    return sec
+}
+
+func (m *marshaller) marshalTagged(sec *outputSection, top bool, v reflect.Value) error {
+    t := v.Type()
+    // media[*] lines go to every media description, so they wait until the
+    // other fields have added theirs, whatever the order of the fields
+    for _, all := range []bool{false, true} {
+        for i := 0; i < t.NumField(); i++ {
+            field := t.Field(i)
+            tag, ok, err := fieldTag(field)
+            if err != nil {
+                return err
+            }
+            if !ok || (tag.media && tag.selector == "*" && tag.typ != "") != all {
+                continue
+            }
+            sections := []*outputSection{sec}
+            if tag.media && !top {
+                return fmt.Errorf("%w: media selector on field %s inside a media description", ErrInvalidTag, field.Name)
+            }
+            if tag.media && tag.typ == "" {
+                if err := m.marshalMedia(tag, v.Field(i), field); err != nil {
+                    return err
+                }
+                continue
+            }
+            if tag.media {
+                if sections, err = m.sections(tag.selector); err != nil {
+                    return err
+                }
+            }
+            if len(sections) == 0 && !isEmptyField(v.Field(i)) {
+                return fmt.Errorf("%w: field %s selects media[*] but no field adds a media description", ErrInvalidTag, field.Name)
+            }
+            for _, sec := range sections {
+                if err := m.marshalLines(sec, tag, v.Field(i)); err != nil {
+                    return err
+                }
+            }
+        }
+    }
+    return nil
+}
+
+// isEmptyField reports fields Marshal writes no line for.
+func isEmptyField(v reflect.Value) bool {
+    switch v.Kind() {
+    case reflect.Slice:
+        return v.Len() == 0
+    case reflect.Bool:
+        return !v.Bool()
+    }
+    return v.IsZero()
+}
+
+// marshalMedia adds a media description for a struct, or for every element
+// of a slice of structs.
+func (m *marshaller) marshalMedia(tag sdpTag, v reflect.Value, field reflect.StructField) error {
+    var elements []reflect.Value
+    switch {
+    case v.Kind() == reflect.Slice:
+        for i := 0; i < v.Len(); i++ {
+            elements = append(elements, v.Index(i))
+        }
+    default:
+        elements = append(elements, v)
+    }
+    for _, el := range elements {
+        if el.Kind() == reflect.Ptr {
+            if el.IsNil() {
+                continue
+            }
+            el = el.Elem()
+        }
+        if el.Kind() != reflect.Struct {
+            return fmt.Errorf("%w: field %s of type %s cannot hold a media description", ErrInvalidTag, field.Name, v.Type())
+        }
+        sec, err := m.groupSection(tag.selector)
+        if err != nil {
+            return err
+        }
+        if err := m.marshalTagged(sec, false, el); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func (m *marshaller) marshalLines(sec *outputSection, tag sdpTag, v reflect.Value) error {
+    switch v.Kind() {
+    case reflect.Bool:
+        if tag.typ != "a" {
+            return fmt.Errorf("%w: bool field for %s= lines", ErrInvalidTag, tag.typ)
+        }
+        if v.Bool() {
+            sec.lines = append(sec.lines, typedLine{typ: "a", text: "a=" + tag.name})
+        }
+        return nil
+    case reflect.Slice:
+        for i := 0; i < v.Len(); i++ {
+            if err := m.marshalLine(sec, tag, v.Index(i)); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+    return m.marshalLine(sec, tag, v)
+}
+
+func (m *marshaller) marshalLine(sec *outputSection, tag sdpTag, v reflect.Value) error {
+    if v.Kind() == reflect.Ptr {
+        if v.IsNil() {
+            return nil
+        }
+        v = v.Elem()
+    } else if v.IsZero() {
+        return nil
+    }
+
+    var text string
+    if v.Kind() == reflect.Struct {
+        var err error
+        if text, err = m.formatStruct(tag, v); err != nil {
+            return err
+        }
+    } else {
+        s, err := scalarText(v)
+        if err != nil {
+            return &WriteError{Type: tag.typ, Rule: tag.name, Err: err}
+        }
+        if strings.IndexFunc(s, isControl) != -1 {
+            return &WriteError{Type: tag.typ, Rule: tag.name, Err: ErrControlCharacter}
+        }
+        text = tag.typ + "=" + s
+        if tag.typ == "a" {
+            text = "a=" + tag.name + ":" + s
+        }
+    }
+    if tag.typ == "m" {
+        _, content, _ := strings.Cut(text, "=")
+        fields := strings.Fields(content)
+        if len(fields) == 0 {
+            return &WriteError{Type: "m", Err: fmt.Errorf("%w: m= line without a media type", ErrInvalidTag)}
+        }
+        sec.media = fields[0]
+    }
+    sec.lines = append(sec.lines, typedLine{typ: tag.typ, text: text})
+    return nil
+}
+
+// formatStruct writes a line from the values of a struct with the first
+// grammar rule of the line type that formats them into a line it parses back,
+// for the attribute of the tag.
+func (m *marshaller) formatStruct(tag sdpTag, v reflect.Value) (string, error) {
+    values := map[string]string{}
+    t := v.Type()
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        name, ok := field.Tag.Lookup("sdp")
+        if !ok || name == "-" || field.PkgPath != "" {
+            continue
+        }
+        fv := v.Field(i)
+        if fv.Kind() == reflect.Ptr {
+            if fv.IsNil() {
+                continue
+            }
+            fv = fv.Elem()
+        } else if fv.Kind() == reflect.String && fv.Len() == 0 {
+            continue
+        }
+        s, err := scalarText(fv)
+        if err != nil {
+            return "", &WriteError{Type: tag.typ, Rule: tag.name, Field: name, Err: err}
+        }
+        values[name] = s
+    }
+
+    for _, rule := range m.grammar[tag.typ] {
+        if rule.Parent != "" || rule.Push == "invalid" {
+            continue
+        }
+        if rule.Push == "" && rule.Name != "" && len(rule.Names) == 0 {
+            if _, ok := values[rule.Name]; !ok {
+                continue
+            }
+        }
+        text, err := makeLine(tag.typ, *rule, mapValues(values), SanitizeReject)
+        if err != nil {
+            return "", err
+        }
+        _, content, _ := strings.Cut(text, "=")
+        if name, _, _ := strings.Cut(content, ":"); tag.typ == "a" && name != tag.name {
+            continue
+        }
+        if _, err := matchRule(rule, content, nil); err != nil {
+            continue
+        }
+        return text, nil
+    }
+    return "", &WriteError{Type: tag.typ, Rule: tag.name, Err: fmt.Errorf("%w: no grammar rule writes %s", ErrInvalidTag, t)}
+}
@@ -0,0 +1,191 @@
+package sdp_transform
+
+import (
+    "errors"
+    "reflect"
+    "strconv"
+    "testing"
+)
+
+type testCodec struct {
+    Payload  int     `sdp:"payload"`
+    Name     string  `sdp:"codec"`
+    Rate     *int    `sdp:"rate"`
+    Channels *string `sdp:"encoding"`
+}
+
+type testMediaSection struct {
+    M       string       `sdp:"m="`
+    Mid     string       `sdp:"a=mid"`
+    Codecs  []*testCodec `sdp:"a=rtpmap"`
+    RtcpMux bool         `sdp:"a=rtcp-mux"`
+}
+
+func TestUnmarshal(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=call\r\n" +
+        "t=0 0\r\n" +
+        "a=group:BUNDLE 0 1\r\n" +
+        "m=audio 54400 RTP/AVP 0 111\r\n" +
+        "a=mid:0\r\n" +
+        "a=ice-ufrag:F7gI\r\n" +
+        "a=rtpmap:0 PCMU/8000\r\n" +
+        "a=rtpmap:111 opus/48000/2\r\n" +
+        "a=rtcp-mux\r\n" +
+        "m=video 55400 RTP/AVP 96\r\n" +
+        "a=mid:1\r\n" +
+        "a=rtpmap:96 VP8/90000\r\n"
+
+    var v struct {
+        Version     int                `sdp:"v="`
+        Name        string             `sdp:"s="`
+        Groups      []string           `sdp:"a=group"`
+        Ufrag       string             `sdp:"media[0].a=ice-ufrag"`
+        VideoCodecs []testCodec        `sdp:"media[video].a=rtpmap"`
+        Mids        []string           `sdp:"media[*].a=mid"`
+        Audio       *testMediaSection  `sdp:"media[audio]"`
+        Media       []testMediaSection `sdp:"media[*]"`
+        Missing     *testMediaSection  `sdp:"media[application]"`
+        Ignored     string
+    }
+    if err := Unmarshal([]byte(sdp), &v); err != nil {
+        t.Fatal(err)
+    }
+    if v.Version != 0 || v.Name != "call" || !reflect.DeepEqual(v.Groups, []string{"BUNDLE 0 1"}) || v.Ufrag != "F7gI" {
+        t.Fatalf("unexpected session fields %+v", v)
+    }
+    if len(v.VideoCodecs) != 1 || v.VideoCodecs[0].Name != "VP8" || *v.VideoCodecs[0].Rate != 90000 {
+        t.Fatalf("unexpected video codecs %+v", v.VideoCodecs)
+    }
+    if !reflect.DeepEqual(v.Mids, []string{"0", "1"}) {
+        t.Fatalf("unexpected mids %q", v.Mids)
+    }
+    if v.Audio == nil || v.Audio.M != "audio 54400 RTP/AVP 0 111" || !v.Audio.RtcpMux || len(v.Audio.Codecs) != 2 ||
+        v.Audio.Codecs[1].Payload != 111 || *v.Audio.Codecs[1].Channels != "2" || v.Audio.Codecs[0].Channels != nil {
+        t.Fatalf("unexpected audio %+v", v.Audio)
+    }
+    if len(v.Media) != 2 || v.Media[1].Mid != "1" || v.Media[1].RtcpMux || v.Missing != nil {
+        t.Fatalf("unexpected media %+v", v.Media)
+    }
+
+    var bad struct {
+        Port uint8 `sdp:"media[0].a=mid"`
+    }
+    err := Unmarshal([]byte("v=0\r\nm=audio 1 RTP/AVP 0\r\na=mid:300\r\n"), &bad)
+    var parseErr *ParseError
+    if !errors.As(err, &parseErr) || parseErr.Line != 3 || !errors.Is(err, strconv.ErrRange) {
+        t.Fatalf("expected a range error at line 3, got %v", err)
+    }
+}
+
+func TestMarshal(t *testing.T) {
+    rate := 48000
+    channels := "2"
+    v := struct {
+        Version int                 `sdp:"v="`
+        Origin  string              `sdp:"o="`
+        Name    string              `sdp:"s="`
+        Timing  string              `sdp:"t="`
+        Group   string              `sdp:"a=group"`
+        Ufrag   string              `sdp:"media[audio].a=ice-ufrag"`
+        Media   []*testMediaSection `sdp:"media[audio]"`
+    }{
+        Version: 0,
+        Origin:  "- 20518 0 IN IP4 203.0.113.1",
+        Name:    "call",
+        Timing:  "0 0",
+        Group:   "BUNDLE 0",
+        Ufrag:   "F7gI",
+        Media: []*testMediaSection{{
+            M:       "audio 54400 RTP/AVP 111",
+            Mid:     "0",
+            Codecs:  []*testCodec{{Payload: 111, Name: "opus", Rate: &rate, Channels: &channels}},
+            RtcpMux: true,
+        }},
+    }
+    out, err := Marshal(&v)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // zero numbers are left out, so v= needs a pointer or a string
+    expected := "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=call\r\n" +
+        "t=0 0\r\n" +
+        "a=group:BUNDLE 0\r\n" +
+        "m=audio 54400 RTP/AVP 111\r\n" +
+        "a=ice-ufrag:F7gI\r\n" +
+        "a=mid:0\r\n" +
+        "a=rtpmap:111 opus/48000/2\r\n" +
+        "a=rtcp-mux\r\n"
+    if string(out) != expected {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    var back struct {
+        Media []*testMediaSection `sdp:"media[audio]"`
+    }
+    if err := Unmarshal(out, &back); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(back.Media, v.Media) {
+        t.Fatalf("unexpected round trip %+v", back.Media[0])
+    }
+
+    // media[*] fields declared ahead of the media descriptions still reach them
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=call\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/AVP 0\r\n" +
+        "a=mid:0\r\n"
+    var ordered struct {
+        Mids    []string `sdp:"media[*].a=mid"`
+        Version string   `sdp:"v="`
+        Origin  string   `sdp:"o="`
+        Name    string   `sdp:"s="`
+        Timing  string   `sdp:"t="`
+        Media   []struct {
+            M string `sdp:"m="`
+        } `sdp:"media[*]"`
+    }
+    if err := Unmarshal([]byte(sdp), &ordered); err != nil {
+        t.Fatal(err)
+    }
+    if out, err := Marshal(&ordered); err != nil || string(out) != sdp {
+        t.Fatalf("unexpected output %v:\n%s", err, out)
+    }
+
+    for _, test := range []interface{}{
+        struct {
+            A string `sdp:"a="`
+        }{"x"},
+        struct {
+            Mids []string `sdp:"media[*].a=mid"`
+        }{[]string{"0"}},
+        struct {
+            A string `sdp:"media[].a=mid"`
+        }{"x"},
+        struct {
+            M struct {
+                A string `sdp:"media[0].a=mid"`
+            } `sdp:"media[0]"`
+        }{},
+        struct {
+            A string `sdp:"media[video].a=mid"`
+        }{"0"},
+        struct {
+            A string `sdp:"s="`
+        }{"a\r\nb"},
+        struct {
+            M string `sdp:"media[0].m="`
+        }{"  "},
+        struct {
+            M *struct{} `sdp:"media[0].m="`
+        }{&struct{}{}},
+    } {
+        if _, err := Marshal(test); !errors.Is(err, ErrInvalidTag) && !errors.Is(err, ErrControlCharacter) {
+            t.Fatalf("expected an error for %+v, got %v", test, err)
+        }
+    }
+}
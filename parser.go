@@ -1,141 +1,352 @@
 package sdp_transform
 
 import (
-    "bufio"
-    "encoding/json"
-    "github.com/dlclark/regexp2"
+    "errors"
+    "reflect"
+    "regexp"
+    "sort"
     "strconv"
     "strings"
+    "time"
 )
 
-func attachProperties(match *regexp2.Match, location map[string]interface{}, names []string, rawName string) {
-    if rawName != "" && len(names) == 0 {
-        if len(match.Groups()) != 0 {
-            location[rawName] = match.Groups()[1].String()
-        } else {
-            location[rawName] = match.String()
+// matchRule runs the rule against the content of a line and returns the values
+// it captured, keyed by the rule's names (or its name when it captures a
+// single value). When spans is not nil it receives the byte range of every
+// returned value within the content.
+func matchRule(rule *Rule, content string, spans map[string]Span) (map[string]string, error) {
+    match := rule.Reg.FindStringSubmatchIndex(content)
+    if match == nil {
+        return nil, errNoMatch
+    }
+    // match holds the start and end offsets of the whole match, then of every
+    // group; unmatched groups are -1.
+    groups := len(match)/2 - 1
+    values := make(map[string]string, len(rule.Names)+1)
+    if rule.Name != "" && len(rule.Names) == 0 {
+        start, end := match[0], match[1]
+        if groups > 0 {
+            start, end = match[2], match[3]
         }
-    } else {
-        for i, v := range names {
-            val := match.Groups()[i+1].String()
-            if val != "" {
-                location[v] = val
-            }
+        if start < 0 {
+            start, end = 0, 0
         }
-    }
-}
-
-func parseReg(rule Rule, location map[string]interface{}, content string) {
-    if rule.Push != "" {
-        _, ok := location[rule.Push]
-        if !ok {
-            location[rule.Push] = []map[string]interface{}{}
+        values[rule.Name] = content[start:end]
+        if spans != nil {
+            spans[rule.Name] = Span{Column: start, EndColumn: end}
         }
+        return values, nil
     }
-    if rule.Name != "" {
-        _, ok := location[rule.Name]
-        if !ok {
-            location[rule.Name] = map[string]interface{}{}
+    for i, v := range rule.Names {
+        if i >= groups {
+            break
+        }
+        start, end := match[2*i+2], match[2*i+3]
+        if start < 0 || start == end {
+            continue
+        }
+        values[v] = content[start:end]
+        if spans != nil {
+            spans[v] = Span{Column: start, EndColumn: end}
         }
     }
-    keyLocatin := map[string]interface{}{}
-    if rule.Push != "" {
-        //
-    } else if rule.Name != "" && len(rule.Names) != 0 {
-        keyLocatin = location[rule.Name].(map[string]interface{})
-    } else {
-        keyLocatin = location
+    return values, nil
+}
+
+// ParseOptions
+// Controls how strictly a description is checked while it is parsed.
+type ParseOptions struct {
+    // Strict rejects descriptions that break the RFC 8866 structure: lines out
+    // of order, missing v=/o=/s=/t=, session-level lines after the first m=,
+    // repeated single-occurrence lines, lines the grammar cannot match,
+    // numbers that do not fit their type (such as a port above 65535), and
+    // control characters other than tab, which Write would reject.
+    Strict bool
+    // Lenient trims stray whitespace, drops fields that do not fit the struct
+    // model instead of failing, and records a Diagnostic for everything it
+    // skipped, dropped or repaired.
+    Lenient bool
+    // PreserveLayout records the original text and order of every line, so
+    // that Write reproduces the description byte for byte and only rewrites
+    // the lines whose values were changed.
+    PreserveLayout bool
+
+    // Limits for untrusted input; zero means no limit. Going over a limit
+    // fails with a *LimitError.
+    //
+    // MaxSize bounds the input in bytes, MaxLineLength every line without
+    // its ending, MaxLines the number of lines, MaxMediaSections the number
+    // of m= lines and MaxAttributes the number of a= lines of the session or
+    // of any one media description.
+    MaxSize          int
+    MaxLineLength    int
+    MaxLines         int
+    MaxMediaSections int
+    MaxAttributes    int
+    // LineTimeout bounds the time spent matching a single line against the
+    // grammar. Matching is linear in the length of the line, so the limit is
+    // checked once each line has been matched.
+    LineTimeout time.Duration
+
+    // positions is set by ParseWithPositions.
+    positions bool
+}
+
+func Parse(description string) (*SessionDescription, error) {
+    return ParseWithOptions(description, ParseOptions{})
+}
+
+func ParseWithOptions(description string, options ParseOptions) (*SessionDescription, error) {
+    return NewParser(defaultGrammar).ParseWithOptions(description, options)
+}
+
+// ParseLenient parses the description in lenient mode and returns the
+// diagnostics collected along the way.
+func ParseLenient(description string) (*SessionDescription, []Diagnostic, error) {
+    return NewParser(defaultGrammar).ParseLenient(description)
+}
+
+// Parser
+// Parses descriptions with a grammar of its own, such as a Clone of the default
+// grammar extended for one dialect. A Parser is safe for concurrent use; every
+// parse uses the rules of the grammar at the time it starts.
+type Parser struct {
+    grammar *Grammar
+}
+
+// NewParser returns a parser for the grammar, or for the default grammar when
+// it is nil.
+func NewParser(grammar *Grammar) *Parser {
+    if grammar == nil {
+        grammar = defaultGrammar
     }
+    return &Parser{grammar: grammar}
+}
 
-    matched, err := rule.Reg.FindStringMatch(content)
+func (p *Parser) Parse(description string) (*SessionDescription, error) {
+    return p.ParseWithOptions(description, ParseOptions{})
+}
+
+func (p *Parser) ParseWithOptions(description string, options ParseOptions) (*SessionDescription, error) {
+    state, err := p.parse(description, options)
     if err != nil {
-        panic(err)
+        return nil, err
     }
+    return state.result, nil
+}
 
-    //if rule.Name != "" && len(rule.Names) == 0 {
-    //    if len(matched.Groups()) != 0 {
-    //        keyLocatin[rule.Name] = matched.Groups()[1].String()
-    //    } else {
-    //        keyLocatin[rule.Name] = matched.String()
-    //    }
-    //} else {
-    //    for i, v := range rule.Names {
-    //        val := matched.Groups()[i+1].String()
-    //        if val != "" {
-    //            keyLocatin[v] = val
-    //        }
-    //    }
-    //}
+// ParseLenient is the package-level ParseLenient with the parser's grammar.
+func (p *Parser) ParseLenient(description string) (*SessionDescription, []Diagnostic, error) {
+    state, err := p.parse(description, ParseOptions{Lenient: true})
+    if err != nil {
+        return nil, nil, err
+    }
+    return state.result, state.diagnostics, nil
+}
 
-    attachProperties(matched, keyLocatin, rule.Names, rule.Name)
+// section is a session or media description under construction.
+type section struct {
+    // v is the SessionDescription or Media the lines are stored in.
+    v      reflect.Value
+    shared *SharedDescriptionFields
+    // keys, and key.name pairs, of values the struct model cannot hold.
+    dropped map[string]bool
+}
 
-    if rule.Push != "" {
-        arr := location[rule.Push].([]map[string]interface{})
-        arr = append(arr, keyLocatin)
-        location[rule.Push] = arr
-    }
+func newSection(v reflect.Value, shared *SharedDescriptionFields) *section {
+    return &section{v: v, shared: shared, dropped: map[string]bool{}}
 }
 
-func Parse(description string) (*SessionDescription, error) {
-    session := map[string]interface{}{}
-    media := make([]map[string]interface{}, 0)
+type parseState struct {
+    options     ParseOptions
+    grammar     GrammarMap
+    diagnostics []Diagnostic
+    session     *section
+    location    *section
+    layout      *layout
+    ending      LineEnding
+    positions   []slotPosition
 
-    var location map[string]interface{}
-    location = session
+    result    *SessionDescription
+    sourceMap *SourceMap
+}
 
-    validLine := regexp2.MustCompile(`^([a-z])=(.*)`, regexp2.None)
-    scanner := bufio.NewScanner(strings.NewReader(description))
-    for scanner.Scan() {
-        line := scanner.Text()
-        if line == "" {
-            continue
-        }
-        if ok, _ := validLine.MatchString(line); !ok {
-            continue
-        }
+func (parser *Parser) parse(description string, options ParseOptions) (*parseState, error) {
+    s := &SessionDescription{Media: []*Media{}}
+    p := &parseState{
+        options: options,
+        session: newSection(reflect.ValueOf(s).Elem(), &s.SharedDescriptionFields),
+        result:  s,
+    }
+    p.location = p.session
+    if options.PreserveLayout {
+        p.layout = &layout{}
+    }
 
-        match, err := validLine.FindStringMatch(line)
+    decoder := parser.NewDecoder(strings.NewReader(description), options)
+    p.grammar = decoder.grammar
+    s.grammar = p.grammar
+    if err := decoder.Decode(p.handle); err != nil {
+        return nil, err
+    }
+
+    s.LineEnding = p.ending
+    if p.layout != nil {
+        // parsed values may hold control characters; recording must not fail on them
+        sections, err := writeSections(p.grammar, *s, &WriteOptions{Sanitize: SanitizeStrip})
         if err != nil {
             return nil, err
         }
-        typ := match.Groups()[1].String()
-        content := match.Groups()[2].String()
+        p.layout.record(sections)
+        s.layout = p.layout
+    }
+    if options.positions {
+        p.sourceMap = resolvePositions(s, p.positions)
+    }
+    sort.SliceStable(p.diagnostics, func(i, j int) bool {
+        return p.diagnostics[i].Line < p.diagnostics[j].Line
+    })
+    return p, nil
+}
 
-        if typ == "m" {
-            media = append(media, map[string]interface{}{
-                "rtp":  []map[string]interface{}{},
-                "fmtp": []map[string]interface{}{},
-            })
-            location = media[len(media)-1]
+func (p *parseState) diagnose(d Diagnostic) {
+    if p.options.Lenient {
+        p.diagnostics = append(p.diagnostics, d)
+    }
+}
+
+func (p *parseState) handle(ev *Event) error {
+    if ev.Trimmed {
+        p.diagnose(Diagnostic{Kind: DiagnosticTrimmedWhitespace, Line: ev.Line, Raw: ev.Raw})
+    }
+    if ev.control {
+        p.diagnose(Diagnostic{Kind: DiagnosticControlCharacter, Line: ev.Line, Type: ev.Type, Raw: ev.Raw})
+    }
+    if p.ending == "" && (ev.Ending == "\r\n" || ev.Ending == "\n") {
+        p.ending = LineEnding(ev.Ending)
+    }
+    if ev.Kind == EventMediaStart {
+        m := &Media{}
+        m.RTP, m.FMTP = []*RTP{}, []*FMTP{}
+        m.grammar = p.grammar
+        p.result.Media = append(p.result.Media, m)
+        p.location = newSection(reflect.ValueOf(m).Elem(), &m.SharedDescriptionFields)
+    }
+
+    key, index, kept, err := p.apply(ev)
+    if err != nil {
+        return err
+    }
+    slot := ""
+    if kept {
+        slot = slotKey(ev.Type, key, index)
+        if ev.position != nil {
+            p.positions = append(p.positions, slotPosition{media: ev.Media, typ: ev.Type, key: key, index: index, pos: ev.position})
         }
+    }
+    if p.layout != nil {
+        sec := p.layout.section(ev.Media + 1)
+        sec.lines = append(sec.lines, &layoutLine{raw: ev.Raw, ending: ev.Ending, slot: slot})
+    }
+    return nil
+}
 
-        for _, rule := range grammarMap[typ] {
-            if ok, _ := rule.Reg.MatchString(content); ok {
-                parseReg(*rule, location, content)
-                break
-            }
+// apply stores the line in the current section and returns the key and index
+// of the slot it was stored in, with kept false when the line was dropped.
+func (p *parseState) apply(ev *Event) (string, int, bool, error) {
+    if ev.Kind == EventUnknownLine {
+        switch {
+        case ev.Type == "" && ev.Raw == "":
+        case ev.Type == "":
+            p.diagnose(Diagnostic{Kind: DiagnosticSkippedLine, Line: ev.Line, Raw: ev.Raw})
+        case len(p.grammar[ev.Type]) == 0:
+            shared := p.location.shared
+            shared.Unknown = append(shared.Unknown, &UnknownLine{Type: ev.Type, Value: ev.Values["value"]})
+            p.diagnose(Diagnostic{Kind: DiagnosticUnknownLineType, Line: ev.Line, Type: ev.Type, Raw: ev.Raw})
+            return "unknown", len(shared.Unknown) - 1, true, nil
+        default:
+            p.diagnose(Diagnostic{Kind: DiagnosticUnmatchedLine, Line: ev.Line, Type: ev.Type, Raw: ev.Raw})
         }
+        return "", 0, false, nil
     }
-    session["media"] = media
-    marshal, err := json.Marshal(session)
-    if err != nil {
-        return nil, err
+
+    if ev.unmatched {
+        p.diagnose(Diagnostic{Kind: DiagnosticUnmatchedLine, Line: ev.Line, Type: ev.Type, Raw: ev.Raw, Rule: ev.Rule.key(), Message: "kept as written"})
+    }
+    if p.options.Lenient {
+        if field, err := checkNumbers(ev.Rule, ev.Values); err != nil {
+            p.diagnose(Diagnostic{Kind: DiagnosticInvalidNumber, Line: ev.Line, Type: ev.Type, Raw: ev.Raw, Rule: numberField(ev.Rule, field), Message: err.Error()})
+        }
+    }
+    location, key := p.location.v, ev.Rule.key()
+    if ev.Rule.Parent != "" {
+        parents, ok := structField(location, ev.Rule.Parent)
+        if !ok || parents.Kind() != reflect.Slice || parents.Len() == 0 {
+            p.diagnose(Diagnostic{Kind: DiagnosticUnmatchedLine, Line: ev.Line, Type: ev.Type, Raw: ev.Raw, Rule: key})
+            return "", 0, false, nil
+        }
+        location = parents.Index(parents.Len() - 1).Elem()
+        key = nestedKey(ev.Rule.Parent, parents.Len()-1, key)
+    }
+    if ev.Rule.Push == "invalid" {
+        p.diagnose(Diagnostic{Kind: DiagnosticInvalidAttribute, Line: ev.Line, Type: ev.Type, Raw: ev.Raw, Rule: ev.Rule.key()})
+    }
+
+    index, missing, err := assignValues(ev.Rule, location, ev.Values)
+    if errors.Is(err, errNoField) {
+        if ev.Rule.registered {
+            return key, p.location.shared.Extensions.add(ev.Rule, ev.Values, ev.Attribute), true, nil
+        }
+        p.drop(ev, key, "")
+        return "", 0, false, nil
     }
-    var s SessionDescription
-    err = json.Unmarshal(marshal, &s)
     if err != nil {
-        return nil, err
+        if !p.options.Lenient {
+            return "", 0, false, &ParseError{Line: ev.Line, Rule: key, Err: err}
+        }
+        p.drop(ev, key, err.Error())
+        return "", 0, false, nil
     }
-    return &s, nil
+    for _, name := range missing {
+        if ev.Rule.key() != "" {
+            name = key + "." + name
+        }
+        p.drop(ev, name, "")
+    }
+    return key, index, true, nil
+}
+
+// drop reports a value the struct model cannot hold, once per key.
+func (p *parseState) drop(ev *Event, key, message string) {
+    if p.location.dropped[key] {
+        return
+    }
+    p.location.dropped[key] = true
+    p.diagnose(Diagnostic{Kind: DiagnosticDroppedField, Line: ev.Line, Rule: key, Message: message})
+}
+
+// trimLine removes stray whitespace around a line, keeping a value that is
+// only whitespace (such as the recommended "s= ") intact.
+func trimLine(line string) string {
+    line = strings.TrimLeft(line, " \t")
+    if i := strings.Index(line, "="); i != -1 && strings.TrimSpace(line[i+1:]) == "" {
+        return line
+    }
+    return strings.TrimRight(line, " \t")
 }
 
 type ParamMap map[string]*string
 
+var (
+    paramSeparator = regexp.MustCompile(`;\s?`)
+    paramValue     = regexp.MustCompile(`=(.+)`)
+)
+
 func ParseParams(str string) ParamMap {
     paramMap := ParamMap{}
-    params := split(str, `;\s?`, -1)
+    params := split(str, paramSeparator, -1)
     for _, param := range params {
-        s := split(param, `=(.+)`, 2)
+        s := split(param, paramValue, 2)
         if len(s) == 2 {
             paramMap[s[0]] = &s[1]
         } else {
@@ -147,16 +358,16 @@ func ParseParams(str string) ParamMap {
 
 var ParseFmtpConfig = ParseParams
 
-func ParsePayloads(payloads string) []int {
+func ParsePayloads(payloads string) ([]int, error) {
     payloadsNums := make([]int, 0)
     for _, s := range strings.Split(payloads, " ") {
         i, err := strconv.ParseInt(s, 10, 32)
         if err != nil {
-            panic(err)
+            return nil, &ParseError{Type: "m", Raw: payloads, Rule: "media.payloads", Err: err}
         }
         payloadsNums = append(payloadsNums, int(i))
     }
-    return payloadsNums
+    return payloadsNums, nil
 }
 
 type RemoteCandidate struct {
@@ -165,9 +376,12 @@ type RemoteCandidate struct {
     Port      string `json:"port,omitempty"`
 }
 
-func ParseRemoteCandidates(str string) []RemoteCandidate {
+func ParseRemoteCandidates(str string) ([]RemoteCandidate, error) {
     candidates := make([]RemoteCandidate, 0)
     parts := strings.Split(str, " ")
+    if len(parts)%3 != 0 {
+        return nil, &ParseError{Type: "a", Raw: str, Rule: "remoteCandidates", Err: ErrIncompleteRemoteCandidate}
+    }
     for i := 0; i < len(parts); i = i + 3 {
         candidates = append(candidates, RemoteCandidate{
             Component: parts[i],
@@ -175,7 +389,7 @@ func ParseRemoteCandidates(str string) []RemoteCandidate {
             Port:      parts[i+2],
         })
     }
-    return candidates
+    return candidates, nil
 }
 
 func ParseImageAttributes(str string) []ParamMap {
@@ -186,7 +400,7 @@ func ParseImageAttributes(str string) []ParamMap {
         item, _ = strings.CutSuffix(item, "]")
         paramMap := ParamMap{}
         for _, param := range strings.Split(item, ",") {
-            s := split(param, `=(.+)`, 2)
+            s := split(param, paramValue, 2)
             if len(s) == 2 {
                 paramMap[s[0]] = &s[1]
             } else {
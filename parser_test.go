@@ -1,8 +1,13 @@
 package sdp_transform
 
 import (
+    "bufio"
     "encoding/json"
+    "errors"
     "log"
+    "regexp"
+    "strconv"
+    "strings"
     "testing"
 )
 
@@ -222,10 +227,9 @@ a=sendrecv
 }
 
 func TestReg(t *testing.T) {
-    reg := regexp2MustCompile(`^fmtp:(\d*) ([\S| ]*)`)
-    m, _ := reg.FindStringMatch("fmtp:111 minptime=10; useinbandfec=1")
-    for _, group := range m.Groups() {
-        log.Println(group.String())
+    reg := regexp.MustCompile(`^fmtp:(\d*) ([\S| ]*)`)
+    for _, group := range reg.FindStringSubmatch("fmtp:111 minptime=10; useinbandfec=1") {
+        log.Println(group)
     }
 }
 
@@ -234,6 +238,183 @@ func TestParseParams(t *testing.T) {
 }
 
 func TestSplit(t *testing.T) {
-    log.Println(split("pt=97", `=(.+)`, 2))
-    log.Println(split("pt=97;max-width=1280;max-height=720;max-fps=30", `;\s?`, -1))
+    log.Println(split("pt=97", paramValue, 2))
+    log.Println(split("pt=97;max-width=1280;max-height=720;max-fps=30", paramSeparator, -1))
+}
+
+func TestParseErrorLine(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/SAVP 0\r\n" +
+        "a=fmtp:0 " + strings.Repeat("x", bufio.MaxScanTokenSize) + "\r\n"
+
+    _, err := Parse(sdp)
+    var parseErr *ParseError
+    if !errors.As(err, &parseErr) || !errors.Is(err, bufio.ErrTooLong) {
+        t.Fatalf("expected *ParseError, got %v", err)
+    }
+    if parseErr.Line != 6 {
+        t.Fatalf("unexpected error line %d", parseErr.Line)
+    }
+}
+
+func TestParsePayloads(t *testing.T) {
+    payloads, err := ParsePayloads("111 9 0 8")
+    if err != nil || len(payloads) != 4 || payloads[0] != 111 {
+        t.Fatalf("unexpected payloads %v, %v", payloads, err)
+    }
+
+    _, err = ParsePayloads("webrtc-datachannel")
+    var parseErr *ParseError
+    if !errors.As(err, &parseErr) || parseErr.Rule != "media.payloads" {
+        t.Fatalf("expected *ParseError for payloads, got %v", err)
+    }
+}
+
+func TestParseRemoteCandidates(t *testing.T) {
+    candidates, err := ParseRemoteCandidates("1 203.0.113.1 54400 2 203.0.113.1 54401")
+    if err != nil || len(candidates) != 2 || candidates[1].Port != "54401" {
+        t.Fatalf("unexpected candidates %v, %v", candidates, err)
+    }
+
+    _, err = ParseRemoteCandidates("1 203.0.113.1")
+    if !errors.Is(err, ErrIncompleteRemoteCandidate) {
+        t.Fatalf("expected ErrIncompleteRemoteCandidate, got %v", err)
+    }
+}
+
+func TestParseConnections(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 3724394400 3724394405 IN IP4 198.51.100.1\r\n" +
+        "s=IPTV\r\n" +
+        "c=IN IP4 224.2.1.1/127/3\r\n" +
+        "t=0 0\r\n" +
+        "m=video 51372 RTP/AVP 33\r\n" +
+        "c=IN IP6 ff15::101/3\r\n" +
+        "c=IN IP4 233.252.0.1/64\r\n" +
+        "c=IN IP4 198.51.100.2\r\n"
+
+    description, err := ParseWithOptions(sdp, ParseOptions{Strict: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    session := description.Connections[0]
+    if session.IP != "224.2.1.1" || *session.TTL != "127" || *session.Addresses != "3" {
+        t.Fatalf("unexpected session connection %+v", session)
+    }
+    media := description.Media[0].Connections
+    if len(media) != 3 {
+        t.Fatalf("unexpected media connections %+v", media)
+    }
+    if media[0].Version != "6" || media[0].IP != "ff15::101" || media[0].TTL != nil || *media[0].Addresses != "3" {
+        t.Fatalf("unexpected IP6 connection %+v", media[0])
+    }
+    if ttl, err := media[1].TTLUint8(); err != nil || ttl != 64 || media[1].Addresses != nil {
+        t.Fatalf("unexpected IP4 connection %+v", media[1])
+    }
+    if media[2].IP != "198.51.100.2" || media[2].TTL != nil {
+        t.Fatalf("unexpected unicast connection %+v", media[2])
+    }
+    if out := Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    _, err = ParseWithOptions(sdp+"c=IN IP4 224.2.1.1/300\r\n", ParseOptions{Strict: true})
+    if !errors.Is(err, strconv.ErrRange) {
+        t.Fatalf("expected strconv.ErrRange for TTL, got %v", err)
+    }
+
+    // written as IN IP4 addr/3, the count would come back as the TTL
+    media[2].SetAddresses(3)
+    _, err = WriteWithError(*description, nil)
+    var writeErr *WriteError
+    if !errors.As(err, &writeErr) || writeErr.Field != "ttl" || !errors.Is(err, ErrUnsupportedValue) {
+        t.Fatalf("expected a ttl WriteError, got %v", err)
+    }
+    media[2].Addresses = nil
+
+    // written as IN IP6 addr/5/3, the TTL would come back as the count
+    media[0].SetTTL(5)
+    _, err = WriteWithError(*description, nil)
+    if !errors.As(err, &writeErr) || writeErr.Field != "ttl" || !errors.Is(err, ErrUnsupportedValue) {
+        t.Fatalf("expected a ttl WriteError, got %v", err)
+    }
+}
+
+// benchmarkSDP is a typical browser offer with one audio and one video section.
+const benchmarkSDP = "v=0\r\n" +
+    "o=- 6186858436061843296 2 IN IP4 127.0.0.1\r\n" +
+    "s=-\r\n" +
+    "t=0 0\r\n" +
+    "a=group:BUNDLE 0 1\r\n" +
+    "a=extmap-allow-mixed\r\n" +
+    "a=msid-semantic: WMS stream\r\n" +
+    "m=audio 9 UDP/TLS/RTP/SAVPF 111 63 9 0 8 13 110 126\r\n" +
+    "c=IN IP4 0.0.0.0\r\n" +
+    "a=rtcp:9 IN IP4 0.0.0.0\r\n" +
+    "a=candidate:1467250027 1 udp 2122260223 192.168.0.196 46243 typ host generation 0\r\n" +
+    "a=candidate:1467250027 2 udp 2122260222 192.168.0.196 56280 typ host generation 0\r\n" +
+    "a=candidate:435653019 1 tcp 1845501695 203.0.113.1 0 typ srflx raddr 192.168.0.196 rport 0 tcptype active generation 0\r\n" +
+    "a=ice-ufrag:GhPdTZXCgcDZEmuy\r\n" +
+    "a=ice-pwd:IfMtQsMZMGDEUrhUfiIiJMAQCvYFlwup\r\n" +
+    "a=ice-options:trickle\r\n" +
+    "a=fingerprint:sha-256 45:A7:FA:D6:EE:39:58:CD:77:4E:DD:26:C7:06:42:20:EB:34:E8:83:B8:26:41:E1:EE:63:27:DA:01:72:40:04\r\n" +
+    "a=setup:actpass\r\n" +
+    "a=mid:0\r\n" +
+    "a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level\r\n" +
+    "a=extmap:2 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time\r\n" +
+    "a=sendrecv\r\n" +
+    "a=msid:stream audio\r\n" +
+    "a=rtcp-mux\r\n" +
+    "a=rtpmap:111 opus/48000/2\r\n" +
+    "a=rtcp-fb:111 transport-cc\r\n" +
+    "a=fmtp:111 minptime=10;useinbandfec=1\r\n" +
+    "a=rtpmap:63 red/48000/2\r\n" +
+    "a=fmtp:63 111/111\r\n" +
+    "a=rtpmap:9 G722/8000\r\n" +
+    "a=rtpmap:0 PCMU/8000\r\n" +
+    "a=rtpmap:8 PCMA/8000\r\n" +
+    "a=rtpmap:13 CN/8000\r\n" +
+    "a=rtpmap:110 telephone-event/48000\r\n" +
+    "a=rtpmap:126 telephone-event/8000\r\n" +
+    "a=ssrc:2678770010 cname:TSpmnuMCCrSOjrwt\r\n" +
+    "a=ssrc:2678770010 msid:stream audio\r\n" +
+    "m=video 9 UDP/TLS/RTP/SAVPF 96 97 102 103\r\n" +
+    "c=IN IP4 0.0.0.0\r\n" +
+    "a=rtcp:9 IN IP4 0.0.0.0\r\n" +
+    "a=ice-ufrag:GhPdTZXCgcDZEmuy\r\n" +
+    "a=ice-pwd:IfMtQsMZMGDEUrhUfiIiJMAQCvYFlwup\r\n" +
+    "a=fingerprint:sha-256 45:A7:FA:D6:EE:39:58:CD:77:4E:DD:26:C7:06:42:20:EB:34:E8:83:B8:26:41:E1:EE:63:27:DA:01:72:40:04\r\n" +
+    "a=setup:actpass\r\n" +
+    "a=mid:1\r\n" +
+    "a=extmap:2 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time\r\n" +
+    "a=sendrecv\r\n" +
+    "a=msid:stream video\r\n" +
+    "a=rtcp-mux\r\n" +
+    "a=rtcp-rsize\r\n" +
+    "a=rtpmap:96 VP8/90000\r\n" +
+    "a=rtcp-fb:96 goog-remb\r\n" +
+    "a=rtcp-fb:96 transport-cc\r\n" +
+    "a=rtcp-fb:96 ccm fir\r\n" +
+    "a=rtcp-fb:96 nack\r\n" +
+    "a=rtcp-fb:96 nack pli\r\n" +
+    "a=rtpmap:97 rtx/90000\r\n" +
+    "a=fmtp:97 apt=96\r\n" +
+    "a=rtpmap:102 H264/90000\r\n" +
+    "a=fmtp:102 level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f\r\n" +
+    "a=rtpmap:103 rtx/90000\r\n" +
+    "a=fmtp:103 apt=102\r\n" +
+    "a=ssrc-group:FID 1509080227 3212300328\r\n" +
+    "a=ssrc:1509080227 cname:TSpmnuMCCrSOjrwt\r\n" +
+    "a=ssrc:3212300328 cname:TSpmnuMCCrSOjrwt\r\n"
+
+func BenchmarkParse(b *testing.B) {
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        if _, err := Parse(benchmarkSDP); err != nil {
+            b.Fatal(err)
+        }
+    }
 }
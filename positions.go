@@ -0,0 +1,147 @@
+package sdp_transform
+
+import (
+    "reflect"
+    "strconv"
+    "strings"
+)
+
+// Span
+// A range of 1-based columns within a line; EndColumn is exclusive.
+type Span struct {
+    Column    int
+    EndColumn int
+}
+
+// Position
+// Locates a parsed value in the source description.
+type Position struct {
+    Line int
+    Span
+    // Fields gives the span of every value the grammar rule captured, keyed
+    // by the rule's names, or by its name when it captures a single value.
+    Fields map[string]Span
+}
+
+// SourceMap
+// Maps the values of a parsed description back to the lines they came from.
+// Values are looked up by pointer: a *Candidate, *RTP, *FMTP, *Ext, *Origin,
+// *Media, the *string of a single-valued attribute such as MID, and so on.
+type SourceMap struct {
+    positions map[interface{}]*Position
+}
+
+// Position returns where v was parsed from. v must be a pointer taken from the
+// description the SourceMap was returned with.
+func (m *SourceMap) Position(v interface{}) (*Position, bool) {
+    if m == nil || v == nil {
+        return nil, false
+    }
+    pos, ok := m.positions[v]
+    return pos, ok
+}
+
+// ParseWithPositions parses the description like ParseWithOptions and also
+// returns a SourceMap locating every parsed value.
+func ParseWithPositions(description string, options ParseOptions) (*SessionDescription, *SourceMap, error) {
+    return NewParser(defaultGrammar).ParseWithPositions(description, options)
+}
+
+// ParseWithPositions is the package-level ParseWithPositions with the parser's
+// grammar.
+func (p *Parser) ParseWithPositions(description string, options ParseOptions) (*SessionDescription, *SourceMap, error) {
+    options.positions = true
+    state, err := p.parse(description, options)
+    if err != nil {
+        return nil, nil, err
+    }
+    return state.result, state.sourceMap, nil
+}
+
+func newPosition(ev *Event, line string, spans map[string]Span) *Position {
+    // columns are reported against the raw line, before lenient trimming
+    lead := len(ev.Raw) - len(strings.TrimLeft(ev.Raw, " \t"))
+    if !ev.Trimmed {
+        lead = 0
+    }
+    pos := &Position{
+        Line:   ev.Line,
+        Span:   Span{Column: lead + 1, EndColumn: lead + len(line) + 1},
+        Fields: make(map[string]Span, len(spans)),
+    }
+    // the content of a line starts after "<type>="
+    offset := lead + len(ev.Type) + 2
+    for name, span := range spans {
+        pos.Fields[name] = Span{Column: span.Column + offset, EndColumn: span.EndColumn + offset}
+    }
+    return pos
+}
+
+// slotPosition is the position of a line parsed into a slot, resolved to a
+// pointer once the description has been built.
+type slotPosition struct {
+    media int
+    typ   string
+    key   string
+    index int
+    pos   *Position
+}
+
+func resolvePositions(s *SessionDescription, slots []slotPosition) *SourceMap {
+    m := &SourceMap{positions: map[interface{}]*Position{}}
+    for _, slot := range slots {
+        var section reflect.Value
+        if slot.media < 0 {
+            section = reflect.ValueOf(s).Elem()
+        } else if slot.media < len(s.Media) {
+            section = reflect.ValueOf(s.Media[slot.media]).Elem()
+        } else {
+            continue
+        }
+        if slot.typ == "m" {
+            m.positions[s.Media[slot.media]] = slot.pos
+            continue
+        }
+        if v, ok := slotValue(section, slot.key, slot.index); ok {
+            m.positions[v] = slot.pos
+        }
+    }
+    return m
+}
+
+// slotValue returns the pointer stored in the field with the given json name,
+// or its element at index for slices. Keys of nested rules are resolved
+// through their parent element first.
+func slotValue(section reflect.Value, key string, index int) (interface{}, bool) {
+    if i := strings.LastIndex(key, "."); i != -1 {
+        parent := key[:i]
+        j := strings.LastIndex(parent, "#")
+        if j == -1 {
+            return nil, false
+        }
+        parentIndex, err := strconv.Atoi(parent[j+1:])
+        if err != nil {
+            return nil, false
+        }
+        v, ok := slotValue(section, parent[:j], parentIndex)
+        if !ok {
+            return nil, false
+        }
+        return slotValue(reflect.ValueOf(v).Elem(), key[i+1:], index)
+    }
+    field, ok := jsonFields(section.Type())[key]
+    if !ok {
+        return nil, false
+    }
+    v := section.FieldByIndex(field.Index)
+    if index >= 0 {
+        if v.Kind() != reflect.Slice || index >= v.Len() {
+            return nil, false
+        }
+        v = v.Index(index)
+    }
+    if v.Kind() != reflect.Ptr || v.IsNil() {
+        return nil, false
+    }
+    return v.Interface(), true
+}
@@ -0,0 +1,57 @@
+package sdp_transform
+
+import (
+    "testing"
+)
+
+func TestParseWithPositions(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/SAVPF 111\r\n" +
+        "a=rtpmap:111 opus/48000/2\r\n" +
+        "a=fmtp:111 minptime=10\r\n" +
+        "a=extmap:1 urn:ietf:params:rtp-hdrext:ssrc-audio-level\r\n" +
+        "a=mid:0\r\n" +
+        "  a=candidate:0 1 UDP 2113667327 203.0.113.1 54400 typ host\r\n"
+
+    description, sourceMap, err := ParseWithPositions(sdp, ParseOptions{Lenient: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    media := description.Media[0]
+
+    tests := []struct {
+        value interface{}
+        line  int
+        span  Span
+    }{
+        {description.Origin, 2, Span{1, 31}},
+        {media, 5, Span{1, 28}},
+        {media.RTP[0], 6, Span{1, 26}},
+        {media.FMTP[0], 7, Span{1, 23}},
+        {media.Ext[0], 8, Span{1, 55}},
+        {media.MID, 9, Span{1, 8}},
+        {media.Candidates[0], 10, Span{3, 60}},
+    }
+    for _, tt := range tests {
+        pos, ok := sourceMap.Position(tt.value)
+        if !ok {
+            t.Errorf("no position for %T on line %d", tt.value, tt.line)
+            continue
+        }
+        if pos.Line != tt.line || pos.Span != tt.span {
+            t.Errorf("%T: expected line %d %v, got line %d %v", tt.value, tt.line, tt.span, pos.Line, pos.Span)
+        }
+    }
+
+    pos, _ := sourceMap.Position(media.Candidates[0])
+    if ip := pos.Fields["ip"]; ip != (Span{34, 45}) {
+        t.Errorf("unexpected candidate ip span %v", ip)
+    }
+    pos, _ = sourceMap.Position(media.RTP[0])
+    if codec := pos.Fields["codec"]; codec != (Span{14, 18}) {
+        t.Errorf("unexpected rtpmap codec span %v", codec)
+    }
+}
@@ -0,0 +1,127 @@
+package sdp_transform
+
+import (
+    "errors"
+    "fmt"
+)
+
+var (
+    ErrInvalidLine        = errors.New("line is not of the form <type>=<value>")
+    ErrUnknownLineType    = errors.New("unknown line type")
+    ErrLineOrder          = errors.New("line out of order")
+    ErrMissingLine        = errors.New("required line missing")
+    ErrSessionLineInMedia = errors.New("session-level line inside a media description")
+    ErrDuplicateLine      = errors.New("line appears more than once")
+    ErrMalformedLine      = errors.New("line does not match the grammar")
+)
+
+// RFC 8866 section 5 order of the session-level and media-level lines.
+var sessionLineRank = map[string]int{
+    "v": 0, "o": 1, "s": 2, "i": 3, "u": 4, "e": 5, "p": 6,
+    "c": 7, "b": 8, "t": 9, "r": 9, "z": 10, "k": 11, "a": 12,
+}
+var mediaLineRank = map[string]int{
+    "m": 0, "i": 1, "c": 2, "b": 3, "k": 4, "a": 5,
+}
+
+// lines that may only appear once per session or media description.
+var sessionSingleLines = map[string]bool{
+    "v": true, "o": true, "s": true, "i": true, "u": true, "c": true, "z": true, "k": true,
+}
+var mediaSingleLines = map[string]bool{
+    "i": true, "k": true,
+}
+
+var requiredSessionLines = []string{"v", "o", "s", "t"}
+
+// structureChecker enforces the line order and cardinality rules of RFC 8866
+// while a description is parsed in strict mode.
+type structureChecker struct {
+    inMedia  bool
+    lastType string
+    rank     int
+    seen     map[string]int
+    session  map[string]int
+}
+
+func newStructureChecker() *structureChecker {
+    return &structureChecker{
+        rank:    -1,
+        seen:    map[string]int{},
+        session: map[string]int{},
+    }
+}
+
+func (c *structureChecker) check(lineNo int, typ, line string) error {
+    fail := func(err error) error {
+        return &ParseError{Line: lineNo, Type: typ, Raw: line, Err: err}
+    }
+
+    if typ == "m" {
+        if c.missingSessionLine() != "" {
+            return fail(fmt.Errorf("%w: %s= before the first media description", ErrMissingLine, c.missingSessionLine()))
+        }
+        c.inMedia = true
+        c.seen = map[string]int{}
+        c.rank = -1
+    }
+
+    ranks, single := sessionLineRank, sessionSingleLines
+    if c.inMedia {
+        ranks, single = mediaLineRank, mediaSingleLines
+    }
+
+    rank, ok := ranks[typ]
+    if !ok {
+        if _, known := sessionLineRank[typ]; known {
+            return fail(ErrSessionLineInMedia)
+        }
+        return fail(ErrUnknownLineType)
+    }
+
+    // checked first so that a repeated v=, o= or s= is reported as such
+    // rather than as out of order.
+    if single[typ] && c.seen[typ] != 0 {
+        return fail(fmt.Errorf("%w: first seen at line %d", ErrDuplicateLine, c.seen[typ]))
+    }
+
+    // v, o and s must open the description in exactly this order.
+    if !c.inMedia && rank <= 2 && rank != c.rank+1 {
+        return fail(fmt.Errorf("%w: expected %s= as line %d", ErrLineOrder, typ, rank+1))
+    }
+    if !c.inMedia && rank > 2 && c.rank < 2 {
+        return fail(fmt.Errorf("%w: %s= before v=, o= and s=", ErrLineOrder, typ))
+    }
+    if rank < c.rank {
+        return fail(fmt.Errorf("%w: %s= after %s=", ErrLineOrder, typ, c.lastType))
+    }
+    if typ == "r" && c.lastType != "t" && c.lastType != "r" {
+        return fail(fmt.Errorf("%w: r= must follow t=", ErrLineOrder))
+    }
+
+    if c.seen[typ] == 0 {
+        c.seen[typ] = lineNo
+    }
+    if !c.inMedia {
+        c.session[typ] = c.seen[typ]
+    }
+    c.rank = rank
+    c.lastType = typ
+    return nil
+}
+
+func (c *structureChecker) missingSessionLine() string {
+    for _, typ := range requiredSessionLines {
+        if c.session[typ] == 0 {
+            return typ
+        }
+    }
+    return ""
+}
+
+func (c *structureChecker) finish() error {
+    if typ := c.missingSessionLine(); typ != "" {
+        return &ParseError{Type: typ, Err: fmt.Errorf("%w: %s=", ErrMissingLine, typ)}
+    }
+    return nil
+}
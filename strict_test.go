@@ -0,0 +1,57 @@
+package sdp_transform
+
+import (
+    "errors"
+    "strings"
+    "testing"
+)
+
+const strictSDP = "v=0\r\n" +
+    "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+    "s=-\r\n" +
+    "c=IN IP4 203.0.113.1\r\n" +
+    "t=0 0\r\n" +
+    "a=ice-ufrag:F7gI\r\n" +
+    "m=audio 54400 RTP/SAVPF 0\r\n" +
+    "c=IN IP4 203.0.113.1\r\n" +
+    "a=rtpmap:0 PCMU/8000\r\n"
+
+func TestParseStrict(t *testing.T) {
+    if _, err := ParseWithOptions(strictSDP, ParseOptions{Strict: true}); err != nil {
+        t.Fatalf("valid description rejected: %v", err)
+    }
+
+    tests := []struct {
+        name string
+        sdp  string
+        line int
+        err  error
+    }{
+        {"order", strings.Replace(strictSDP, "s=-\r\n", "", 1) + "s=-\r\n", 3, ErrLineOrder},
+        {"missing timing", strings.Replace(strictSDP, "t=0 0\r\n", "", 1), 6, ErrMissingLine},
+        {"session line in media", strictSDP + "t=0 0\r\n", 10, ErrSessionLineInMedia},
+        {"duplicate", strings.Replace(strictSDP, "t=0 0\r\n", "t=0 0\r\nc=IN IP4 203.0.113.2\r\n", 1), 6, ErrDuplicateLine},
+        {"duplicate in order", strings.Replace(strictSDP, "s=-\r\n", "s=-\r\ni=a\r\ni=b\r\n", 1), 5, ErrDuplicateLine},
+        {"duplicate s", strings.Replace(strictSDP, "s=-\r\n", "s=-\r\ns=again\r\n", 1), 4, ErrDuplicateLine},
+        {"duplicate v", strings.Replace(strictSDP, "v=0\r\n", "v=0\r\nv=0\r\n", 1), 2, ErrDuplicateLine},
+        {"attribute after media", strictSDP + "i=late\r\n", 10, ErrLineOrder},
+        {"invalid line", strictSDP + "garbage\r\n", 10, ErrInvalidLine},
+        {"unknown type", strictSDP + "x=1\r\n", 10, ErrUnknownLineType},
+        {"malformed", strings.Replace(strictSDP, "c=IN IP4 203.0.113.1\r\nt", "c=IN\r\nt", 1), 4, ErrMalformedLine},
+        {"control character", strings.Replace(strictSDP, "s=-", "s=a\x01b", 1), 3, ErrControlCharacter},
+    }
+    for _, tt := range tests {
+        _, err := ParseWithOptions(tt.sdp, ParseOptions{Strict: true})
+        var parseErr *ParseError
+        if !errors.As(err, &parseErr) || !errors.Is(err, tt.err) {
+            t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+            continue
+        }
+        if parseErr.Line != tt.line {
+            t.Errorf("%s: expected line %d, got %d", tt.name, tt.line, parseErr.Line)
+        }
+        if _, err = Parse(tt.sdp); err != nil {
+            t.Errorf("%s: default parse failed: %v", tt.name, err)
+        }
+    }
+}
@@ -0,0 +1,199 @@
+package sdp_transform
+
+import (
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// ntpEpochOffset is the number of seconds from the NTP epoch (1900) to the Unix
+// epoch (1970).
+const ntpEpochOffset = 2208988800
+
+// compactUnits are the RFC 8866 time units, largest first.
+var compactUnits = []struct {
+    suffix byte
+    unit   time.Duration
+}{
+    {'d', 24 * time.Hour},
+    {'h', time.Hour},
+    {'m', time.Minute},
+    {'s', time.Second},
+}
+
+// NTPToTime converts an NTP timestamp in seconds to a time. 0, which SDP uses
+// for unbounded sessions, converts to the zero time.
+func NTPToTime(ntp uint64) time.Time {
+    if ntp == 0 {
+        return time.Time{}
+    }
+    return time.Unix(int64(ntp)-ntpEpochOffset, 0).UTC()
+}
+
+// TimeToNTP converts a time to an NTP timestamp in seconds, the zero time to 0.
+func TimeToNTP(t time.Time) uint64 {
+    if t.IsZero() {
+        return 0
+    }
+    return uint64(t.Unix() + ntpEpochOffset)
+}
+
+// ParseCompactDuration parses a number of seconds, optionally in the compact
+// form of RFC 8866 such as 7d, 1h, 30m or -1h.
+func ParseCompactDuration(value string) (time.Duration, error) {
+    return parseCompactDuration("duration", value)
+}
+
+func parseCompactDuration(field, value string) (time.Duration, error) {
+    digits, unit := value, time.Second
+    for _, u := range compactUnits {
+        if strings.HasSuffix(value, string(u.suffix)) {
+            digits, unit = value[:len(value)-1], u.unit
+            break
+        }
+    }
+    n, err := strconv.ParseInt(digits, 10, 64)
+    if err != nil {
+        return 0, numberError(field, value, err)
+    }
+    return time.Duration(n) * unit, nil
+}
+
+// FormatCompactDuration formats a duration in the largest unit that represents
+// it exactly, truncated to whole seconds.
+func FormatCompactDuration(d time.Duration) string {
+    d = d.Truncate(time.Second)
+    if d == 0 {
+        return "0"
+    }
+    for _, u := range compactUnits[:len(compactUnits)-1] {
+        if d%u.unit == 0 {
+            return fmt.Sprintf("%d%c", d/u.unit, u.suffix)
+        }
+    }
+    return strconv.FormatInt(int64(d/time.Second), 10)
+}
+
+func (t *Timing) StartTime() (time.Time, error) {
+    n, err := t.StartUint64()
+    return NTPToTime(n), err
+}
+
+func (t *Timing) SetStartTime(start time.Time) {
+    t.SetStart(TimeToNTP(start))
+}
+
+func (t *Timing) StopTime() (time.Time, error) {
+    n, err := t.StopUint64()
+    return NTPToTime(n), err
+}
+
+func (t *Timing) SetStopTime(stop time.Time) {
+    t.SetStop(TimeToNTP(stop))
+}
+
+func (r *Repeat) IntervalDuration() (time.Duration, error) {
+    return parseCompactDuration("repeats.interval", r.Interval)
+}
+
+func (r *Repeat) SetInterval(interval time.Duration) {
+    r.Interval = FormatCompactDuration(interval)
+}
+
+func (r *Repeat) ActiveDuration() (time.Duration, error) {
+    return parseCompactDuration("repeats.active", r.Active)
+}
+
+func (r *Repeat) SetActive(active time.Duration) {
+    r.Active = FormatCompactDuration(active)
+}
+
+func (r *Repeat) OffsetDurations() ([]time.Duration, error) {
+    fields := strings.Fields(r.Offsets)
+    offsets := make([]time.Duration, 0, len(fields))
+    for _, field := range fields {
+        d, err := parseCompactDuration("repeats.offsets", field)
+        if err != nil {
+            return nil, err
+        }
+        offsets = append(offsets, d)
+    }
+    return offsets, nil
+}
+
+func (r *Repeat) SetOffsets(offsets ...time.Duration) {
+    fields := make([]string, 0, len(offsets))
+    for _, d := range offsets {
+        fields = append(fields, FormatCompactDuration(d))
+    }
+    r.Offsets = strings.Join(fields, " ")
+}
+
+// TimeZoneAdjustment
+// One adjustment of a z= line: from Time on, repeat times are shifted by Offset.
+type TimeZoneAdjustment struct {
+    Time   time.Time
+    Offset time.Duration
+}
+
+// TimeZoneAdjustments returns the adjustments of the z= line, or nil when there
+// is none.
+func (s *SessionDescription) TimeZoneAdjustments() ([]TimeZoneAdjustment, error) {
+    if s.Timezones == nil {
+        return nil, nil
+    }
+    fields := strings.Fields(*s.Timezones)
+    if len(fields)%2 != 0 {
+        return nil, &ParseError{Type: "z", Rule: "timezones", Raw: *s.Timezones, Err: ErrMalformedLine}
+    }
+    adjustments := make([]TimeZoneAdjustment, 0, len(fields)/2)
+    for i := 0; i < len(fields); i += 2 {
+        ntp, err := parseUint("timezones", fields[i], 64)
+        if err != nil {
+            return nil, err
+        }
+        offset, err := parseCompactDuration("timezones", fields[i+1])
+        if err != nil {
+            return nil, err
+        }
+        adjustments = append(adjustments, TimeZoneAdjustment{Time: NTPToTime(ntp), Offset: offset})
+    }
+    return adjustments, nil
+}
+
+// SetTimeZoneAdjustments replaces the z= line, removing it when there are no
+// adjustments.
+func (s *SessionDescription) SetTimeZoneAdjustments(adjustments []TimeZoneAdjustment) {
+    if len(adjustments) == 0 {
+        s.Timezones = nil
+        return
+    }
+    fields := make([]string, 0, 2*len(adjustments))
+    for _, a := range adjustments {
+        fields = append(fields, strconv.FormatUint(TimeToNTP(a.Time), 10), FormatCompactDuration(a.Offset))
+    }
+    z := strings.Join(fields, " ")
+    s.Timezones = &z
+}
+
+// AdjustTime applies the z= adjustments to a time computed from the t= and r=
+// lines: it is shifted by the offset of the latest adjustment at or before it.
+func (s *SessionDescription) AdjustTime(t time.Time) (time.Time, error) {
+    adjustments, err := s.TimeZoneAdjustments()
+    if err != nil {
+        return t, err
+    }
+    sort.SliceStable(adjustments, func(i, j int) bool {
+        return adjustments[i].Time.Before(adjustments[j].Time)
+    })
+    var offset time.Duration
+    for _, a := range adjustments {
+        if a.Time.After(t) {
+            break
+        }
+        offset = a.Offset
+    }
+    return t.Add(offset), nil
+}
@@ -0,0 +1,150 @@
+package sdp_transform
+
+import (
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+const timingSDP = "v=0\r\n" +
+    "o=- 3724394400 3724394405 IN IP4 198.51.100.1\r\n" +
+    "s=Seminar\r\n" +
+    "t=3034423619 3042462419\r\n" +
+    "r=7d 1h 0 25h\r\n" +
+    "r=604800 3600 90000\r\n" +
+    "t=3042462419 0\r\n" +
+    "z=2882844526 -1h 2898848070 0\r\n" +
+    "m=audio 49170 RTP/AVP 0\r\n"
+
+func TestParseTimings(t *testing.T) {
+    description, sourceMap, err := ParseWithPositions(timingSDP, ParseOptions{Strict: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(description.Timings) != 2 || len(description.Timings[0].Repeats) != 2 || len(description.Timings[1].Repeats) != 0 {
+        t.Fatalf("unexpected timings %+v", description.Timings)
+    }
+
+    timing := description.Timings[0]
+    if start, err := timing.StartTime(); err != nil || !start.Equal(time.Date(1996, 2, 27, 15, 26, 59, 0, time.UTC)) {
+        t.Fatalf("unexpected start %v, %v", start, err)
+    }
+    if stop, err := description.Timings[1].StopTime(); err != nil || !stop.IsZero() {
+        t.Fatalf("unexpected unbounded stop %v, %v", stop, err)
+    }
+
+    repeat := timing.Repeats[0]
+    interval, _ := repeat.IntervalDuration()
+    active, _ := repeat.ActiveDuration()
+    offsets, err := repeat.OffsetDurations()
+    if err != nil || interval != 7*24*time.Hour || active != time.Hour || !reflect.DeepEqual(offsets, []time.Duration{0, 25 * time.Hour}) {
+        t.Fatalf("unexpected repeat %v %v %v, %v", interval, active, offsets, err)
+    }
+    if pos, ok := sourceMap.Position(timing.Repeats[1]); !ok || pos.Line != 6 {
+        t.Fatalf("unexpected repeat position %+v", pos)
+    }
+
+    if out := Write(*description, nil); out != timingSDP {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    timing.Repeats[1].SetInterval(7 * 24 * time.Hour)
+    timing.Repeats[1].SetActive(time.Hour)
+    timing.Repeats[1].SetOffsets(25 * time.Hour)
+    if out := Write(*description, nil); !strings.Contains(out, "r=7d 1h 0 25h\r\nr=7d 1h 25h\r\nt=3042462419 0\r\n") {
+        t.Fatalf("unexpected compact output:\n%s", out)
+    }
+}
+
+func TestWriteTimingsPreservingLayout(t *testing.T) {
+    sdp := strings.Replace(timingSDP, "r=604800 3600 90000\r\n", "r=604800  3600 90000\r\n", 1)
+    description, err := ParseWithOptions(sdp, ParseOptions{PreserveLayout: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    description.Timings[1].Repeats = append(description.Timings[1].Repeats, &Repeat{Interval: "1d", Active: "2h", Offsets: "0"})
+    want := strings.Replace(sdp, "t=3042462419 0\r\n", "t=3042462419 0\r\nr=1d 2h 0\r\n", 1)
+    if out := Write(*description, nil); out != want {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+}
+
+func TestTimeZoneAdjustments(t *testing.T) {
+    description, err := Parse(timingSDP)
+    if err != nil {
+        t.Fatal(err)
+    }
+    adjustments, err := description.TimeZoneAdjustments()
+    if err != nil || len(adjustments) != 2 || adjustments[0].Offset != -time.Hour || TimeToNTP(adjustments[1].Time) != 2898848070 {
+        t.Fatalf("unexpected adjustments %+v, %v", adjustments, err)
+    }
+
+    before := NTPToTime(2882844525)
+    if adjusted, _ := description.AdjustTime(before); !adjusted.Equal(before) {
+        t.Fatalf("unexpected adjustment before the first change %v", adjusted)
+    }
+    during := NTPToTime(2882844526)
+    if adjusted, _ := description.AdjustTime(during); !adjusted.Equal(during.Add(-time.Hour)) {
+        t.Fatalf("unexpected adjustment %v", adjusted)
+    }
+
+    description.SetTimeZoneAdjustments([]TimeZoneAdjustment{{Time: during, Offset: -90 * time.Minute}})
+    if *description.Timezones != "2882844526 -90m" {
+        t.Fatalf("unexpected z= value %q", *description.Timezones)
+    }
+}
+
+func TestCompactDuration(t *testing.T) {
+    for value, want := range map[string]time.Duration{"0": 0, "90000": 25 * time.Hour, "7d": 7 * 24 * time.Hour, "-1h": -time.Hour, "30m": 30 * time.Minute, "45s": 45 * time.Second} {
+        if d, err := ParseCompactDuration(value); err != nil || d != want {
+            t.Fatalf("unexpected duration for %q: %v, %v", value, d, err)
+        }
+    }
+    if _, err := ParseCompactDuration("1w"); err == nil {
+        t.Fatal("expected an error for an unknown unit")
+    }
+    if s := FormatCompactDuration(90061 * time.Second); s != "90061" {
+        t.Fatalf("unexpected format %q", s)
+    }
+}
+
+func TestRepeatWithoutTiming(t *testing.T) {
+    sdp := "v=0\r\no=- 1 1 IN IP4 198.51.100.1\r\ns=-\r\nr=7d 1h 0\r\nt=0 0\r\n"
+    description, diagnostics, err := ParseLenient(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(description.Timings[0].Repeats) != 0 || len(diagnostics) != 1 || diagnostics[0].Kind != DiagnosticUnmatchedLine || diagnostics[0].Line != 4 {
+        t.Fatalf("unexpected result %+v %+v", description.Timings, diagnostics)
+    }
+}
+
+func TestMalformedTimezones(t *testing.T) {
+    sdp := "v=0\r\no=- 1 1 IN IP4 198.51.100.1\r\ns=-\r\nt=0 0\r\nz=2882844526 -1h 2898848070\r\n"
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if description.Timezones == nil || *description.Timezones != "2882844526 -1h 2898848070" {
+        t.Fatalf("unexpected z= value %v", description.Timezones)
+    }
+    if _, err := description.TimeZoneAdjustments(); !errors.Is(err, ErrMalformedLine) {
+        t.Fatalf("expected ErrMalformedLine, got %v", err)
+    }
+    if out := Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+
+    _, diagnostics, err := ParseLenient(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(diagnostics) != 1 || diagnostics[0].Kind != DiagnosticUnmatchedLine || diagnostics[0].Line != 5 {
+        t.Fatalf("unexpected diagnostics %+v", diagnostics)
+    }
+    if _, err := ParseWithOptions(sdp, ParseOptions{Strict: true}); !errors.Is(err, ErrMalformedLine) {
+        t.Fatalf("expected ErrMalformedLine, got %v", err)
+    }
+}
@@ -0,0 +1,416 @@
+package sdp_transform
+
+import (
+    "errors"
+    "strconv"
+)
+
+// ErrMissingValue is returned by the typed accessors of optional fields that
+// are not set.
+var ErrMissingValue = errors.New("value not present")
+
+// numberKind is the Go type a digit-only grammar value converts to.
+type numberKind int
+
+const (
+    kindPayloadType numberKind = iota // 0-127
+    kindUint8
+    kindUint16
+    kindUint32
+    kindUint64
+    kindFloat64
+)
+
+// numericFields lists, per rule key, the values the grammar defines as
+// numbers. Strict parsing rejects values that do not fit their type.
+var numericFields = map[string]map[string]numberKind{
+    "version":        {"version": kindUint8},
+    "origin":         {"sessionId": kindUint64, "sessionVersion": kindUint64, "ipVer": kindUint8},
+    "timings":        {"start": kindUint64, "stop": kindUint64},
+    "connections":    {"version": kindUint8, "ttl": kindUint8, "addresses": kindUint32},
+    "bandwidth":      {"limit": kindUint64},
+    "":               {"port": kindUint16}, // m= line
+    "rtp":            {"payload": kindPayloadType, "rate": kindUint32},
+    "fmtp":           {"payload": kindPayloadType},
+    "rtcp":           {"port": kindUint16, "ipVer": kindUint8},
+    "rtcpFbTrrInt":   {"value": kindUint32},
+    "ext":            {"value": kindUint16},
+    "crypto":         {"id": kindUint32},
+    "ptime":          {"ptime": kindFloat64},
+    "maxptime":       {"maxptime": kindFloat64},
+    "candidates":     {"component": kindUint16, "priority": kindUint32, "port": kindUint16, "rport": kindUint16, "generation": kindUint32, "network-id": kindUint32, "network-cost": kindUint32},
+    "ssrcs":          {"id": kindUint32},
+    "framerate":      {"framerate": kindFloat64},
+    "sctpPort":       {"sctpPort": kindUint16},
+    "maxMessageSize": {"maxMessageSize": kindUint64},
+    "mediaClk":       {"rateNumerator": kindUint32, "rateDenominator": kindUint32},
+    "bfcpConfId":     {"bfcpConfId": kindUint32},
+    "bfcpUserId":     {"bfcpUserId": kindUint32},
+}
+
+// numberField names a numeric value of a rule in errors and diagnostics, the
+// same way the typed accessors do: "candidates.priority", or "ptime" for rules
+// that capture a single value. The m= rule stores its values in the media
+// description itself, so its values are named after "media".
+func numberField(rule *Rule, field string) string {
+    key := rule.key()
+    if key == "" {
+        key = "media"
+    }
+    if field == key {
+        return key
+    }
+    return key + "." + field
+}
+
+func (k numberKind) check(value string) error {
+    var err error
+    switch k {
+    case kindPayloadType:
+        _, err = strconv.ParseUint(value, 10, 7)
+    case kindUint8:
+        _, err = strconv.ParseUint(value, 10, 8)
+    case kindUint16:
+        _, err = strconv.ParseUint(value, 10, 16)
+    case kindUint32:
+        _, err = strconv.ParseUint(value, 10, 32)
+    case kindUint64:
+        _, err = strconv.ParseUint(value, 10, 64)
+    case kindFloat64:
+        _, err = strconv.ParseFloat(value, 64)
+    }
+    return err
+}
+
+// checkNumbers validates the numeric values a rule captured and returns the
+// name of the first one that does not fit its type.
+func checkNumbers(rule *Rule, values map[string]string) (string, error) {
+    for name, kind := range numericFields[rule.key()] {
+        value, ok := values[name]
+        if !ok {
+            continue
+        }
+        if err := kind.check(value); err != nil {
+            return name, err
+        }
+    }
+    return "", nil
+}
+
+func numberError(field, value string, err error) *ParseError {
+    var numErr *strconv.NumError
+    if errors.As(err, &numErr) {
+        err = numErr.Err
+    }
+    return &ParseError{Rule: field, Raw: value, Err: err}
+}
+
+func parseUint(field, value string, bitSize int) (uint64, error) {
+    n, err := strconv.ParseUint(value, 10, bitSize)
+    if err != nil {
+        return 0, numberError(field, value, err)
+    }
+    return n, nil
+}
+
+func parseOptionalUint(field string, value *string, bitSize int) (uint64, error) {
+    if value == nil {
+        return 0, &ParseError{Rule: field, Err: ErrMissingValue}
+    }
+    return parseUint(field, *value, bitSize)
+}
+
+func parseOptionalFloat(field string, value *string) (float64, error) {
+    if value == nil {
+        return 0, &ParseError{Rule: field, Err: ErrMissingValue}
+    }
+    n, err := strconv.ParseFloat(*value, 64)
+    if err != nil {
+        return 0, numberError(field, *value, err)
+    }
+    return n, nil
+}
+
+func formatUint(n uint64) string {
+    return strconv.FormatUint(n, 10)
+}
+
+func formatOptionalUint(n uint64) *string {
+    s := formatUint(n)
+    return &s
+}
+
+func formatOptionalFloat(n float64) *string {
+    s := strconv.FormatFloat(n, 'f', -1, 64)
+    return &s
+}
+
+func (s *SessionDescription) VersionUint8() (uint8, error) {
+    n, err := parseOptionalUint("version", s.Version, 8)
+    return uint8(n), err
+}
+
+func (s *SessionDescription) SetVersion(version uint8) {
+    s.Version = formatOptionalUint(uint64(version))
+}
+
+func (o *Origin) SessionIDUint64() (uint64, error) {
+    return parseUint("origin.sessionId", o.SessionID, 64)
+}
+
+func (o *Origin) SetSessionID(id uint64) {
+    o.SessionID = formatUint(id)
+}
+
+func (o *Origin) SessionVersionUint64() (uint64, error) {
+    return parseUint("origin.sessionVersion", o.SessionVersion, 64)
+}
+
+func (o *Origin) SetSessionVersion(version uint64) {
+    o.SessionVersion = formatUint(version)
+}
+
+func (o *Origin) IPVerUint8() (uint8, error) {
+    n, err := parseUint("origin.ipVer", o.IPVer, 8)
+    return uint8(n), err
+}
+
+func (t *Timing) StartUint64() (uint64, error) {
+    return parseUint("timings.start", t.Start, 64)
+}
+
+func (t *Timing) SetStart(start uint64) {
+    t.Start = formatUint(start)
+}
+
+func (t *Timing) StopUint64() (uint64, error) {
+    return parseUint("timings.stop", t.Stop, 64)
+}
+
+func (t *Timing) SetStop(stop uint64) {
+    t.Stop = formatUint(stop)
+}
+
+func (c *Connection) VersionUint8() (uint8, error) {
+    n, err := parseUint("connections.version", c.Version, 8)
+    return uint8(n), err
+}
+
+func (c *Connection) TTLUint8() (uint8, error) {
+    n, err := parseOptionalUint("connections.ttl", c.TTL, 8)
+    return uint8(n), err
+}
+
+func (c *Connection) SetTTL(ttl uint8) {
+    c.TTL = formatOptionalUint(uint64(ttl))
+}
+
+func (c *Connection) AddressesUint32() (uint32, error) {
+    n, err := parseOptionalUint("connections.addresses", c.Addresses, 32)
+    return uint32(n), err
+}
+
+func (c *Connection) SetAddresses(addresses uint32) {
+    c.Addresses = formatOptionalUint(uint64(addresses))
+}
+
+func (b *Bandwidth) LimitUint64() (uint64, error) {
+    return parseUint("bandwidth.limit", b.Limit, 64)
+}
+
+func (b *Bandwidth) SetLimit(limit uint64) {
+    b.Limit = formatUint(limit)
+}
+
+func (m *Media) PortUint16() (uint16, error) {
+    n, err := parseUint("media.port", m.Port, 16)
+    return uint16(n), err
+}
+
+func (m *Media) SetPort(port uint16) {
+    m.Port = formatUint(uint64(port))
+}
+
+// PayloadTypes returns the formats of the m= line as payload types.
+func (m *Media) PayloadTypes() ([]int, error) {
+    if m.Payloads == nil {
+        return nil, &ParseError{Rule: "media.payloads", Err: ErrMissingValue}
+    }
+    return ParsePayloads(*m.Payloads)
+}
+
+func (m *Media) PTIMEFloat64() (float64, error) {
+    return parseOptionalFloat("ptime", m.PTIME)
+}
+
+func (m *Media) SetPTIME(ptime float64) {
+    m.PTIME = formatOptionalFloat(ptime)
+}
+
+func (m *Media) MaxPTIMEFloat64() (float64, error) {
+    return parseOptionalFloat("maxptime", m.MaxPTIME)
+}
+
+func (m *Media) SetMaxPTIME(maxPTIME float64) {
+    m.MaxPTIME = formatOptionalFloat(maxPTIME)
+}
+
+func (m *Media) FramerateFloat64() (float64, error) {
+    return parseOptionalFloat("framerate", m.Framerate)
+}
+
+func (m *Media) SetFramerate(framerate float64) {
+    m.Framerate = formatOptionalFloat(framerate)
+}
+
+func (m *Media) SctpPortUint16() (uint16, error) {
+    n, err := parseOptionalUint("sctpPort", m.SctpPort, 16)
+    return uint16(n), err
+}
+
+func (m *Media) SetSctpPort(port uint16) {
+    m.SctpPort = formatOptionalUint(uint64(port))
+}
+
+func (m *Media) MaxMessageSizeUint64() (uint64, error) {
+    return parseOptionalUint("maxMessageSize", m.MaxMessageSize, 64)
+}
+
+func (m *Media) SetMaxMessageSize(size uint64) {
+    m.MaxMessageSize = formatOptionalUint(size)
+}
+
+func (r *RTP) PayloadUint8() (uint8, error) {
+    n, err := parseUint("rtp.payload", r.Payload, 7)
+    return uint8(n), err
+}
+
+func (r *RTP) SetPayload(payload uint8) {
+    r.Payload = formatUint(uint64(payload))
+}
+
+func (r *RTP) RateUint32() (uint32, error) {
+    n, err := parseOptionalUint("rtp.rate", r.Rate, 32)
+    return uint32(n), err
+}
+
+func (r *RTP) SetRate(rate uint32) {
+    r.Rate = formatOptionalUint(uint64(rate))
+}
+
+func (r *RTCP) PortUint16() (uint16, error) {
+    n, err := parseUint("rtcp.port", r.Port, 16)
+    return uint16(n), err
+}
+
+func (r *RTCP) SetPort(port uint16) {
+    r.Port = formatUint(uint64(port))
+}
+
+func (r *RTCPFBTrrInt) ValueUint32() (uint32, error) {
+    n, err := parseUint("rtcpFbTrrInt.value", r.Value, 32)
+    return uint32(n), err
+}
+
+func (r *RTCPFBTrrInt) SetValue(value uint32) {
+    r.Value = formatUint(uint64(value))
+}
+
+func (f *FMTP) PayloadUint8() (uint8, error) {
+    n, err := parseUint("fmtp.payload", f.Payload, 7)
+    return uint8(n), err
+}
+
+func (f *FMTP) SetPayload(payload uint8) {
+    f.Payload = formatUint(uint64(payload))
+}
+
+func (e *Ext) ValueUint16() (uint16, error) {
+    n, err := parseUint("ext.value", e.Value, 16)
+    return uint16(n), err
+}
+
+func (e *Ext) SetValue(value uint16) {
+    e.Value = formatUint(uint64(value))
+}
+
+func (c *Crypto) IDUint32() (uint32, error) {
+    n, err := parseUint("crypto.id", c.ID, 32)
+    return uint32(n), err
+}
+
+func (c *Crypto) SetID(id uint32) {
+    c.ID = formatUint(uint64(id))
+}
+
+func (c *Candidate) ComponentUint16() (uint16, error) {
+    n, err := parseUint("candidates.component", c.Component, 16)
+    return uint16(n), err
+}
+
+func (c *Candidate) SetComponent(component uint16) {
+    c.Component = formatUint(uint64(component))
+}
+
+func (c *Candidate) PriorityUint32() (uint32, error) {
+    n, err := parseUint("candidates.priority", c.Priority, 32)
+    return uint32(n), err
+}
+
+func (c *Candidate) SetPriority(priority uint32) {
+    c.Priority = formatUint(uint64(priority))
+}
+
+func (c *Candidate) PortUint16() (uint16, error) {
+    n, err := parseUint("candidates.port", c.Port, 16)
+    return uint16(n), err
+}
+
+func (c *Candidate) SetPort(port uint16) {
+    c.Port = formatUint(uint64(port))
+}
+
+func (c *Candidate) RportUint16() (uint16, error) {
+    n, err := parseOptionalUint("candidates.rport", c.Rport, 16)
+    return uint16(n), err
+}
+
+func (c *Candidate) SetRport(port uint16) {
+    c.Rport = formatOptionalUint(uint64(port))
+}
+
+func (c *Candidate) GenerationUint32() (uint32, error) {
+    n, err := parseOptionalUint("candidates.generation", c.Generation, 32)
+    return uint32(n), err
+}
+
+func (c *Candidate) SetGeneration(generation uint32) {
+    c.Generation = formatOptionalUint(uint64(generation))
+}
+
+func (c *Candidate) NetworkIDUint32() (uint32, error) {
+    n, err := parseOptionalUint("candidates.network-id", c.NetworkID, 32)
+    return uint32(n), err
+}
+
+func (c *Candidate) SetNetworkID(id uint32) {
+    c.NetworkID = formatOptionalUint(uint64(id))
+}
+
+func (c *Candidate) NetworkCostUint32() (uint32, error) {
+    n, err := parseOptionalUint("candidates.network-cost", c.NetworkCost, 32)
+    return uint32(n), err
+}
+
+func (c *Candidate) SetNetworkCost(cost uint32) {
+    c.NetworkCost = formatOptionalUint(uint64(cost))
+}
+
+func (s *SSRC) IDUint32() (uint32, error) {
+    n, err := parseUint("ssrcs.id", s.ID, 32)
+    return uint32(n), err
+}
+
+func (s *SSRC) SetID(id uint32) {
+    s.ID = formatUint(uint64(id))
+}
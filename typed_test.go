@@ -0,0 +1,80 @@
+package sdp_transform
+
+import (
+    "errors"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+func TestTypedAccessors(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 6186858436061843296 1739497432 IN IP4 0.0.0.0\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/SAVPF 111\r\n" +
+        "a=rtpmap:111 opus/48000/2\r\n" +
+        "a=ptime:20\r\n" +
+        "a=candidate:0 1 UDP 2113667327 203.0.113.1 54400 typ host\r\n"
+
+    description, err := ParseWithOptions(sdp, ParseOptions{Strict: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    media := description.Media[0]
+
+    if v, err := description.Origin.SessionIDUint64(); err != nil || v != 6186858436061843296 {
+        t.Errorf("session id: %v, %v", v, err)
+    }
+    if v, err := media.PortUint16(); err != nil || v != 54400 {
+        t.Errorf("port: %v, %v", v, err)
+    }
+    if v, err := media.RTP[0].PayloadUint8(); err != nil || v != 111 {
+        t.Errorf("payload: %v, %v", v, err)
+    }
+    if v, err := media.PTIMEFloat64(); err != nil || v != 20 {
+        t.Errorf("ptime: %v, %v", v, err)
+    }
+    if v, err := media.Candidates[0].PriorityUint32(); err != nil || v != 2113667327 {
+        t.Errorf("priority: %v, %v", v, err)
+    }
+    if _, err := media.MaxPTIMEFloat64(); !errors.Is(err, ErrMissingValue) {
+        t.Errorf("expected ErrMissingValue, got %v", err)
+    }
+
+    description.Origin.SetSessionVersion(1739497433)
+    media.Candidates[0].SetPriority(1)
+    media.SetMaxPTIME(60)
+    out := Write(*description, nil)
+    for _, line := range []string{"1739497433 IN IP4", "54400 typ host", "a=maxptime:60"} {
+        if !strings.Contains(out, line) {
+            t.Errorf("missing %q in\n%s", line, out)
+        }
+    }
+
+    _, err = ParseWithOptions(strings.Replace(sdp, "2113667327", "9999999999", 1), ParseOptions{Strict: true})
+    var parseErr *ParseError
+    if !errors.As(err, &parseErr) || parseErr.Line != 8 || parseErr.Rule != "candidates.priority" || !errors.Is(err, strconv.ErrRange) {
+        t.Errorf("expected out of range priority error, got %v", err)
+    }
+
+    _, err = ParseWithOptions(strings.Replace(sdp, "54400", "99999", 1), ParseOptions{Strict: true})
+    if !errors.As(err, &parseErr) || parseErr.Line != 5 || parseErr.Rule != "media.port" || !errors.Is(err, strconv.ErrRange) {
+        t.Errorf("expected out of range port error, got %v", err)
+    }
+
+    // the accessors name the values the way strict parsing does
+    media.Port = "99999"
+    if _, err := media.PortUint16(); !errors.As(err, &parseErr) || parseErr.Rule != "media.port" {
+        t.Errorf("expected media.port error, got %v", err)
+    }
+    _, err = ParseWithOptions(strings.Replace(sdp, "v=0", "v=300", 1), ParseOptions{Strict: true})
+    if !errors.As(err, &parseErr) || parseErr.Rule != "version" || !errors.Is(err, strconv.ErrRange) {
+        t.Errorf("expected out of range version error, got %v", err)
+    }
+    ptime := "fast"
+    media.PTIME = &ptime
+    if _, err := media.PTIMEFloat64(); !errors.As(err, &parseErr) || parseErr.Rule != "ptime" {
+        t.Errorf("expected ptime error, got %v", err)
+    }
+}
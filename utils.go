@@ -1,30 +1,28 @@
 package sdp_transform
 
 import (
-    "github.com/dlclark/regexp2"
+    "reflect"
+    "regexp"
+    "strings"
+    "sync"
 )
 
-func split(str, pattern string, limit int) []string {
-    reg := regexp2.MustCompile(pattern, regexp2.None)
+func split(str string, reg *regexp.Regexp, limit int) []string {
     var result []string
     lastIndex := 0
 
     // 用于存储匹配到的索引
-    match, _ := reg.FindStringMatch(string(str))
-
-    for match != nil {
-        start, end := match.Index, match.Index+match.Length
+    for _, match := range reg.FindAllStringSubmatchIndex(str, -1) {
+        start, end := match[0], match[1]
         result = append(result, str[lastIndex:start])
 
-        for _, g := range match.Groups()[1:] {
-            if len(g.Captures) > 0 {
-                result = append(result, g.Captures[0].String())
+        for i := 2; i < len(match); i += 2 {
+            if match[i] >= 0 {
+                result = append(result, str[match[i]:match[i+1]])
             }
         }
 
         lastIndex = end
-        // 查找下一个匹配项
-        match, _ = reg.FindNextMatch(match)
     }
 
     // 添加最后一部分
@@ -37,3 +35,42 @@ func split(str, pattern string, limit int) []string {
     }
     return result
 }
+
+var jsonFieldsCache sync.Map
+
+// jsonFields indexes the fields of a struct type, including promoted fields of
+// embedded structs, by the name of their json tag.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+    for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+        t = t.Elem()
+    }
+    if cached, ok := jsonFieldsCache.Load(t); ok {
+        return cached.(map[string]reflect.StructField)
+    }
+    fields := map[string]reflect.StructField{}
+    if t.Kind() == reflect.Struct {
+        collectJSONFields(t, nil, fields)
+    }
+    jsonFieldsCache.Store(t, fields)
+    return fields
+}
+
+func collectJSONFields(t reflect.Type, index []int, fields map[string]reflect.StructField) {
+    for i := 0; i < t.NumField(); i++ {
+        field := t.Field(i)
+        field.Index = append(append([]int{}, index...), i)
+        if field.Anonymous && field.Type.Kind() == reflect.Struct {
+            collectJSONFields(field.Type, field.Index, fields)
+            continue
+        }
+        name := strings.Split(field.Tag.Get("json"), ",")[0]
+        if name == "" || name == "-" {
+            continue
+        }
+        // shallower fields win, as in encoding/json
+        if existing, ok := fields[name]; ok && len(existing.Index) <= len(field.Index) {
+            continue
+        }
+        fields[name] = field
+    }
+}
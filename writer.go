@@ -1,19 +1,22 @@
 package sdp_transform
 
 import (
-    "encoding/json"
     "fmt"
     "github.com/seamory/sdp-transform-go/pointer"
+    "io"
+    "reflect"
     "regexp"
+    "strconv"
     "strings"
 )
 
+var formatVerb = regexp.MustCompile("%[sdv%]")
+
 // customized util.format - discards excess arguments and can void middle ones
 func format(formatStr string, args ...string) string {
     i := 0
     l := len(args)
-    reg := regexp.MustCompile("%[sdv%]")
-    return reg.ReplaceAllStringFunc(formatStr, func(x string) string {
+    return formatVerb.ReplaceAllStringFunc(formatStr, func(x string) string {
         if i > l-1 {
             return x
         }
@@ -33,59 +36,92 @@ func format(formatStr string, args ...string) string {
     })
 }
 
-func convertMapStringString(msi map[string]interface{}) map[string]string {
-    m := make(map[string]string)
-    for k, v := range msi {
-        m[k] = v.(string)
+// lineValue converts a value of the description to the text of a line.
+func lineValue(v interface{}) (string, error) {
+    switch v := v.(type) {
+    case nil:
+        return "", nil
+    case string:
+        return v, nil
+    case int:
+        return strconv.Itoa(v), nil
+    case int64:
+        return strconv.FormatInt(v, 10), nil
+    case uint64:
+        return strconv.FormatUint(v, 10), nil
+    case float64:
+        return strconv.FormatFloat(v, 'f', -1, 64), nil
     }
-    return m
+    return "", fmt.Errorf("%w: %T", ErrUnsupportedValue, v)
 }
 
-func makeLine(typ string, obj Rule, location map[string]interface{}) string {
-    var str string
-    if obj.Push != "" {
-        str = obj.Format(convertMapStringString(location))
-    } else {
-        m, ok := location[obj.Name].(map[string]interface{})
-        if !ok {
-            str = obj.Format(nil)
-        } else {
-            str = obj.Format(convertMapStringString(m))
-        }
+// isControl reports characters that could end a line early or inject another
+// one: C0 controls other than tab, and DEL.
+func isControl(r rune) bool {
+    return (r < 0x20 && r != '\t') || r == 0x7f
+}
+
+func sanitizeValue(s string, policy SanitizePolicy) (string, error) {
+    if strings.IndexFunc(s, isControl) == -1 {
+        return s, nil
     }
+    if policy == SanitizeStrip {
+        return strings.Map(func(r rune) rune {
+            if isControl(r) {
+                return -1
+            }
+            return r
+        }, s), nil
+    }
+    return "", ErrControlCharacter
+}
 
-    args := make([]string, 0)
-    args = append(args, fmt.Sprintf("%s=%s", typ, str))
+// lineValues looks up the values of a line by name, reporting whether the
+// description holds them.
+type lineValues func(name string) (string, bool, error)
 
-    if len(obj.Names) != 0 {
-        for i, name := range obj.Names {
-            if obj.Name != "" {
-                m, ok := location[obj.Name].(map[string]interface{})
-                if !ok {
-                    args = append(args, "")
-                } else {
-                    args = append(args, m[name].(string))
-                }
-            } else {
-                s, ok := location[obj.Names[i]].(string)
-                if !ok {
-                    args = append(args, "")
-                } else {
-                    args = append(args, s)
-                }
+// structValues looks up the values of a line in the fields of the struct v.
+func structValues(v reflect.Value) lineValues {
+    return func(name string) (string, bool, error) {
+        return fieldString(v, name)
+    }
+}
 
-            }
+// mapValues looks up the values of a line in m.
+func mapValues(m map[string]string) lineValues {
+    return func(name string) (string, bool, error) {
+        s, ok := m[name]
+        return s, ok, nil
+    }
+}
+
+func makeLine(typ string, obj Rule, values lineValues, policy SanitizePolicy) (string, error) {
+    names := obj.Names
+    if obj.Push == "" && obj.Name != "" && len(names) == 0 {
+        names = []string{obj.Name}
+    }
+
+    m := make(map[string]string, len(names))
+    args := make([]string, 0, len(names))
+    for _, name := range names {
+        s, ok, err := values(name)
+        if err == nil {
+            s, err = sanitizeValue(s, policy)
         }
-    } else {
-        s, ok := location[obj.Name].(string)
-        if !ok {
-            args = append(args, "")
-        } else {
-            args = append(args, s)
+        if err != nil {
+            return "", &WriteError{Type: typ, Rule: obj.key(), Field: name, Err: err}
         }
+        if ok {
+            m[name] = s
+        }
+        args = append(args, s)
     }
-
-    return format(args[0], args[1:]...)
+    if obj.check != nil {
+        if name, err := obj.check(m); err != nil {
+            return "", &WriteError{Type: typ, Rule: obj.key(), Field: name, Err: err}
+        }
+    }
+    return format(fmt.Sprintf("%s=%s", typ, obj.Format(m)), args...), nil
 }
 
 // RFC specified order
@@ -93,78 +129,395 @@ func makeLine(typ string, obj Rule, location map[string]interface{}) string {
 var DefaultOuterOrder = []string{
     "v", "o", "s", "i",
     "u", "e", "p", "c",
-    "b", "t", "r", "z", "a",
+    "b", "t", "r", "z", "k", "a",
 }
-var DefaultInnerOrder = []string{"i", "c", "b", "a"}
+var DefaultInnerOrder = []string{"i", "c", "b", "k", "a"}
+
+type LineEnding string
+
+const (
+    LineEndingCRLF LineEnding = "\r\n"
+    LineEndingLF   LineEnding = "\n"
+    // LineEndingPreserve writes the line ending the description was parsed with.
+    LineEndingPreserve LineEnding = "preserve"
+)
+
+// SanitizePolicy decides what the writer does with values that contain line
+// breaks or other control characters, which would otherwise let a value such
+// as a session name inject extra lines into the description.
+type SanitizePolicy int
+
+const (
+    // SanitizeReject fails with a *WriteError wrapping ErrControlCharacter.
+    SanitizeReject SanitizePolicy = iota
+    // SanitizeStrip removes the control characters from the value.
+    SanitizeStrip
+)
 
 type WriteOptions struct {
     OuterOrder []string
     InnerOrder []string
+    // LineEnding defaults to CRLF, except for descriptions parsed with
+    // ParseOptions.PreserveLayout, which keep the endings of their lines.
+    LineEnding LineEnding
+    // Sanitize defaults to SanitizeReject.
+    Sanitize SanitizePolicy
 }
 
+// Write returns the description as text, or "" when it cannot be written;
+// use WriteWithError to find out why.
 func Write(session SessionDescription, options *WriteOptions) string {
+    sdp, _ := WriteWithError(session, options)
+    return sdp
+}
+
+// WriteWithError is Write reporting values that cannot be written as a
+// *WriteError.
+func WriteWithError(session SessionDescription, options *WriteOptions) (string, error) {
+    sb := &strings.Builder{}
+    if _, err := WriteTo(sb, session, options); err != nil {
+        return "", err
+    }
+    return sb.String(), nil
+}
+
+// WriteTo writes the description to w line by line and returns the number of
+// bytes written. Nothing is written when the description cannot be written.
+func WriteTo(w io.Writer, session SessionDescription, options *WriteOptions) (int64, error) {
+    return NewWriter(defaultGrammar).WriteTo(w, session, options)
+}
+
+// Writer
+// Writes descriptions with a grammar of its own, the counterpart of Parser. A
+// Writer is safe for concurrent use.
+type Writer struct {
+    grammar *Grammar
+}
+
+// NewWriter returns a writer for the grammar, or for the default grammar when
+// it is nil.
+func NewWriter(grammar *Grammar) *Writer {
+    if grammar == nil {
+        grammar = defaultGrammar
+    }
+    return &Writer{grammar: grammar}
+}
+
+func (wr *Writer) Write(session SessionDescription, options *WriteOptions) string {
+    sdp, _ := wr.WriteWithError(session, options)
+    return sdp
+}
+
+func (wr *Writer) WriteWithError(session SessionDescription, options *WriteOptions) (string, error) {
+    sb := &strings.Builder{}
+    if _, err := wr.WriteTo(sb, session, options); err != nil {
+        return "", err
+    }
+    return sb.String(), nil
+}
+
+func (wr *Writer) WriteTo(w io.Writer, session SessionDescription, options *WriteOptions) (int64, error) {
+    sections, err := writeSections(wr.grammar.snapshot(), session, options)
+    if err != nil {
+        return 0, err
+    }
+
+    var ending LineEnding
+    if options != nil {
+        ending = options.LineEnding
+    }
+    if ending == LineEndingPreserve {
+        ending = session.LineEnding
+    }
+    cw := &countingWriter{w: w}
+    if session.layout != nil {
+        session.layout.write(cw, sections, string(ending))
+        return cw.n, cw.err
+    }
+    if ending == "" {
+        ending = LineEndingCRLF
+    }
+
+    for _, sec := range sections {
+        for _, line := range sec {
+            cw.WriteString(line.text)
+            cw.WriteString(string(ending))
+        }
+    }
+    return cw.n, cw.err
+}
+
+// countingWriter counts the bytes written to w and keeps the first error,
+// after which it writes nothing.
+type countingWriter struct {
+    w   io.Writer
+    n   int64
+    err error
+}
+
+func (cw *countingWriter) WriteString(s string) {
+    if cw.err != nil {
+        return
+    }
+    n, err := io.WriteString(cw.w, s)
+    cw.n += int64(n)
+    cw.err = err
+}
 
+// writtenLine is a line produced by the writer, tagged with the slot of the
+// description it was written from.
+type writtenLine struct {
+    slot string
+    text string
+}
+
+// slotKey identifies the value a line is parsed into or written from: the
+// line type and rule key, plus the element index for push rules.
+func slotKey(typ, key string, index int) string {
+    if index < 0 {
+        return typ + ":" + key
+    }
+    return fmt.Sprintf("%s:%s#%d", typ, key, index)
+}
+
+// nestedKey is the key of a rule nested under the element at index of its
+// parent's list.
+func nestedKey(parent string, index int, key string) string {
+    return fmt.Sprintf("%s#%d.%s", parent, index, key)
+}
+
+// writeSections writes the session description followed by one section per
+// media description.
+func writeSections(grammar GrammarMap, session SessionDescription, options *WriteOptions) ([][]writtenLine, error) {
     if session.Version == nil {
         session.Version = pointer.String("")
     }
     for _, mLine := range session.Media {
-        if mLine.Payloads == nil {
+        if mLine != nil && mLine.Payloads == nil {
             mLine.Payloads = pointer.String("")
         }
     }
 
-    marshal, err := json.Marshal(session)
-    if err != nil {
-        return ""
-    }
-    var s map[string]interface{}
-    err = json.Unmarshal(marshal, &s)
-    if err != nil {
-        return ""
-    }
-
     outerOrder := DefaultOuterOrder
     innerOrder := DefaultInnerOrder
+    w := &sectionWriter{grammar: grammar, policy: SanitizeReject}
     if options != nil && len(options.OuterOrder) != 0 {
         outerOrder = options.OuterOrder
     }
     if options != nil && len(options.InnerOrder) != 0 {
         innerOrder = options.InnerOrder
     }
+    if options != nil {
+        w.policy = options.Sanitize
+    }
+
+    sec, err := w.sectionLines(outerOrder, reflect.ValueOf(&session).Elem(), &session.SharedDescriptionFields)
+    if err != nil {
+        return nil, err
+    }
+    sections := [][]writtenLine{sec}
 
-    sdp := make([]string, 0)
+    for i, media := range session.Media {
+        if media == nil {
+            return nil, &WriteError{Field: "media", Err: fmt.Errorf("%w: nil element %d", ErrUnsupportedValue, i)}
+        }
+        v := reflect.ValueOf(media).Elem()
+        text, err := makeLine("m", *grammar["m"][0], structValues(v), w.policy)
+        if err != nil {
+            return nil, err
+        }
+        lines, err := w.sectionLines(innerOrder, v, &media.SharedDescriptionFields)
+        if err != nil {
+            return nil, err
+        }
+        sections = append(sections, append([]writtenLine{{slot: slotKey("m", "", -1), text: text}}, lines...))
+    }
+    return sections, nil
+}
+
+// sectionWriter writes the lines of a session or media description with the
+// rules of a grammar.
+type sectionWriter struct {
+    grammar GrammarMap
+    policy  SanitizePolicy
+}
+
+// ruleLines writes the lines of a top-level rule from the fields of v, or from
+// the extensions when v holds no value for the rule.
+func (w *sectionWriter) ruleLines(order []string, typ string, obj *Rule, v reflect.Value, ext Extensions) ([]writtenLine, error) {
+    key := obj.key()
+    switch {
+    case obj.Name != "":
+        values := structValues(v)
+        if field, ok := setField(v, obj.Name); ok && len(obj.Names) != 0 {
+            if field.Kind() != reflect.Ptr || field.Elem().Kind() != reflect.Struct {
+                return nil, &WriteError{Type: typ, Rule: key, Err: fmt.Errorf("%w: %s", ErrUnsupportedValue, field.Type())}
+            }
+            values = structValues(field.Elem())
+        } else if !ok {
+            value, ok := ext[key]
+            if !ok || value == nil {
+                return nil, nil
+            }
+            if s, ok := ext.String(key); ok && len(obj.Names) == 0 {
+                values = mapValues(map[string]string{obj.Name: s})
+            } else if m, ok := ext.Values(key); ok && len(obj.Names) != 0 {
+                values = mapValues(m)
+            } else {
+                return nil, &WriteError{Type: typ, Rule: key, Err: fmt.Errorf("%w: %T", ErrUnsupportedValue, value)}
+            }
+        }
+        text, err := makeLine(typ, *obj, values, w.policy)
+        if err != nil {
+            return nil, err
+        }
+        return []writtenLine{{slot: slotKey(typ, key, -1), text: text}}, nil
+    case obj.Push != "":
+        if list, ok := setField(v, obj.Push); ok {
+            return w.pushLines(order, typ, obj, key, list)
+        }
+        return w.extensionLines(typ, obj, ext[key])
+    }
+    return nil, nil
+}
 
-    for _, typ := range outerOrder {
-        for _, obj := range grammarMap[typ] {
-            if v, ok := s[obj.Name]; ok && v != nil {
-                sdp = append(sdp, makeLine(typ, *obj, s))
-            } else if v, ok = s[obj.Push]; ok && v != nil {
-                m := s[obj.Push].([]interface{})
-                for _, val := range m {
-                    sdp = append(sdp, makeLine(typ, *obj, val.(map[string]interface{})))
+// pushLines writes a line for every element of the list a push rule builds,
+// each followed by the lines of the rules nested under it.
+func (w *sectionWriter) pushLines(order []string, typ string, obj *Rule, key string, list reflect.Value) ([]writtenLine, error) {
+    t := list.Type()
+    if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Ptr || t.Elem().Elem().Kind() != reflect.Struct {
+        return nil, &WriteError{Type: typ, Rule: obj.key(), Err: fmt.Errorf("%w: %s is not a list", ErrUnsupportedValue, t)}
+    }
+    lines := make([]writtenLine, 0, list.Len())
+    for i := 0; i < list.Len(); i++ {
+        el := list.Index(i)
+        if el.IsNil() {
+            return nil, &WriteError{Field: obj.Push, Err: fmt.Errorf("%w: nil element %d", ErrUnsupportedValue, i)}
+        }
+        el = el.Elem()
+        text, err := makeLine(typ, *obj, structValues(el), w.policy)
+        if err != nil {
+            return nil, err
+        }
+        lines = append(lines, writtenLine{slot: slotKey(typ, key, i), text: text})
+        for _, childTyp := range order {
+            for _, child := range w.grammar[childTyp] {
+                if child.Parent != obj.Push {
+                    continue
+                }
+                children, ok := setField(el, child.Push)
+                if !ok {
+                    continue
+                }
+                nested, err := w.pushLines(order, childTyp, child, nestedKey(obj.Push, i, child.key()), children)
+                if err != nil {
+                    return nil, err
                 }
+                lines = append(lines, nested...)
             }
         }
     }
+    return lines, nil
+}
 
-    medias := s["media"].([]interface{})
-    for _, media := range medias {
-        mLine := media.(map[string]interface{})
-        sdp = append(sdp, makeLine("m", *grammarMap["m"][0], mLine))
+// extensionLines writes a line for every element of the extension value of a
+// push rule: a list of values, or the attributes of a codec.
+func (w *sectionWriter) extensionLines(typ string, obj *Rule, value interface{}) ([]writtenLine, error) {
+    var elements []lineValues
+    switch value := value.(type) {
+    case nil:
+        return nil, nil
+    case []map[string]string:
+        for _, m := range value {
+            elements = append(elements, mapValues(m))
+        }
+    case []AttributeCodec:
+        for _, codec := range value {
+            if codec == nil {
+                continue
+            }
+            m := map[string]string{}
+            if s := codec.Marshal(); s != "" {
+                m["value"] = s
+            }
+            elements = append(elements, mapValues(m))
+        }
+    default:
+        return nil, &WriteError{Type: typ, Rule: obj.key(), Err: fmt.Errorf("%w: %T is not a list", ErrUnsupportedValue, value)}
+    }
+    lines := make([]writtenLine, 0, len(elements))
+    for i, values := range elements {
+        text, err := makeLine(typ, *obj, values, w.policy)
+        if err != nil {
+            return nil, err
+        }
+        lines = append(lines, writtenLine{slot: slotKey(typ, obj.key(), i), text: text})
+    }
+    return lines, nil
+}
 
-        for _, typ := range innerOrder {
-            for _, obj := range grammarMap[typ] {
-                if v, ok := mLine[obj.Name]; ok && v != nil {
-                    sdp = append(sdp, makeLine(typ, *obj, mLine))
-                } else if v, ok = mLine[obj.Push]; ok && v != nil {
-                    m := mLine[obj.Push].([]interface{})
-                    for _, el := range m {
-                        sdp = append(sdp, makeLine(typ, *obj, el.(map[string]interface{})))
-                    }
-                }
+// sectionLines writes the lines of a session or media description in the given
+// order. Unknown lines kept by Parse are written with the other lines of their
+// type, or ahead of the attributes when their type is not part of the order.
+func (w *sectionWriter) sectionLines(order []string, v reflect.Value, shared *SharedDescriptionFields) ([]writtenLine, error) {
+    lines := make([]writtenLine, 0)
+    inOrder := map[string]bool{}
+    for _, typ := range order {
+        inOrder[typ] = true
+    }
+
+    var unknownErr error
+    writeUnknown := func(match func(typ string) bool) {
+        for i, line := range shared.Unknown {
+            if unknownErr != nil {
+                return
+            }
+            if line == nil {
+                unknownErr = &WriteError{Field: "unknown", Err: fmt.Errorf("%w: nil element %d", ErrUnsupportedValue, i)}
+                return
+            }
+            if !match(line.Type) {
+                continue
+            }
+            typ := line.Type
+            if len(typ) != 1 || typ[0] < 'a' || typ[0] > 'z' {
+                unknownErr = &WriteError{Type: typ, Rule: "unknown", Field: "type", Err: fmt.Errorf("%w: line type %q", ErrUnsupportedValue, typ)}
+                return
+            }
+            value, err := sanitizeValue(line.Value, w.policy)
+            if err != nil {
+                unknownErr = &WriteError{Type: typ, Rule: "unknown", Field: "value", Err: err}
+                return
             }
+            lines = append(lines, writtenLine{
+                slot: slotKey(typ, "unknown", i),
+                text: fmt.Sprintf("%s=%s", typ, value),
+            })
         }
     }
 
-    return fmt.Sprintf("%s\r\n", strings.Join(sdp, "\r\n"))
+    for _, typ := range order {
+        if typ == "a" {
+            writeUnknown(func(t string) bool { return !inOrder[t] })
+        }
+        for _, obj := range w.grammar[typ] {
+            if obj.Parent != "" {
+                continue
+            }
+            ruleLines, err := w.ruleLines(order, typ, obj, v, shared.Extensions)
+            if err != nil {
+                return nil, err
+            }
+            lines = append(lines, ruleLines...)
+        }
+        current := typ
+        writeUnknown(func(t string) bool { return t == current })
+    }
+    if !inOrder["a"] {
+        writeUnknown(func(t string) bool { return !inOrder[t] })
+    }
+    if unknownErr != nil {
+        return nil, unknownErr
+    }
+    return lines, nil
 }
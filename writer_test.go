@@ -1,8 +1,11 @@
 package sdp_transform
 
 import (
-    "github.com/seamory/mediasou-client-go/sdp_transform/pointer"
+    "bytes"
+    "errors"
+    "github.com/seamory/sdp-transform-go/pointer"
     "log"
+    "strings"
     "testing"
 )
 
@@ -224,3 +227,248 @@ a=sendrecv
 
     log.Println(Write(*description, nil))
 }
+
+func TestWriteUnknownLines(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "x=private\r\n" +
+        "y=vendor\r\n" +
+        "a=ice-ufrag:F7gI\r\n" +
+        "m=audio 54400 RTP/SAVPF 0\r\n" +
+        "c=IN IP4 203.0.113.1\r\n" +
+        "y=vendor\r\n" +
+        "a=rtpmap:0 PCMU/8000\r\n"
+
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(description.Unknown) != 2 || description.Unknown[1].Type != "y" || len(description.Media[0].Unknown) != 1 {
+        t.Fatalf("unknown lines not kept: %+v %+v", description.Unknown, description.Media[0].Unknown)
+    }
+    if out := Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+}
+
+func TestWriteLineEnding(t *testing.T) {
+    sdp := "v=0\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\n" +
+        "s=-\n" +
+        "t=0 0\n" +
+        "m=audio 54400 RTP/AVP 0\n"
+
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if description.LineEnding != LineEndingLF {
+        t.Fatalf("expected LF line ending, got %q", description.LineEnding)
+    }
+    if out := Write(*description, nil); out != strings.ReplaceAll(sdp, "\n", "\r\n") {
+        t.Fatalf("expected CRLF by default, got %q", out)
+    }
+    if out := Write(*description, &WriteOptions{LineEnding: LineEndingPreserve}); out != sdp {
+        t.Fatalf("expected preserved LF, got %q", out)
+    }
+
+    description, err = ParseWithOptions(sdp, ParseOptions{PreserveLayout: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if out := Write(*description, &WriteOptions{LineEnding: LineEndingCRLF}); out != strings.ReplaceAll(sdp, "\n", "\r\n") {
+        t.Fatalf("expected CRLF override, got %q", out)
+    }
+}
+
+func TestWriteGrammarAttributes(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "a=ts-refclk:ptp=IEEE1588-2008:39-A7-94-FF-FE-07-CB-D0:37\r\n" +
+        "a=mediaclk:direct=963214424\r\n" +
+        "a=keywds:conference\r\n" +
+        "m=application 50000 TCP/TLS/BFCP *\r\n" +
+        "a=extmap:3 urn:ietf:params:rtp-hdrext:encrypt urn:ietf:params:rtp-hdrext:smpte-tc 25@600/24\r\n" +
+        "a=setup:passive\r\n" +
+        "a=connection:new\r\n" +
+        "a=bundle-only\r\n" +
+        "a=label:1\r\n" +
+        "a=content:main\r\n" +
+        "a=floorctrl:s-only\r\n" +
+        "a=confid:4321\r\n" +
+        "a=userid:1234\r\n" +
+        "a=floorid:1 mstrm:10\r\n"
+
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    media := description.Media[0]
+    if description.TSRefClocks[0].ClkSrc != "ptp" || *description.MediaClk.MediaClockValue != "963214424" ||
+        *description.Keywords != "conference" || *media.Ext[0].EncryptUri != "urn:ietf:params:rtp-hdrext:encrypt" ||
+        *media.ConnectionType != "new" || media.BundleOnly == nil || *media.Label != "1" || *media.Content != "main" ||
+        *media.BFCPFloorCtrl != "s-only" || *media.BFCPConfID != "4321" || *media.BFCPUserID != "1234" ||
+        media.BFCPFloorID.MStream != "10" {
+        t.Fatalf("attributes not parsed: %+v", media)
+    }
+    if out := Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+}
+
+func TestWriteCrypto(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "m=audio 54400 RTP/SAVP 0\r\n" +
+        "a=crypto:1 AES_CM_128_HMAC_SHA1_80 inline:PS1uQCVeeCFCanVmcjkpPywjNWhcYD0mXXtxaVBR|2^20|1:32\r\n" +
+        "a=crypto:2 AES_CM_128_HMAC_SHA1_32 inline:NzB4d1BINUAvLEw6UzF3WSJ+PSdFcGdUJShpX1Zj|2^20|1:32\r\n" +
+        "a=crypto:3 AEAD_AES_256_GCM inline:HGAPy4Cedkeqb5LgT5YaJXNTyJXqtoAu1/MfMdeC6LAKbVUjuNdYPyAXtSs= UNENCRYPTED_SRTCP\r\n"
+
+    description, err := Parse(sdp)
+    if err != nil {
+        t.Fatal(err)
+    }
+    crypto := description.Media[0].Crypto
+    if len(crypto) != 3 || crypto[1].Suite != "AES_CM_128_HMAC_SHA1_32" || *crypto[2].SessionConfig != "UNENCRYPTED_SRTCP" {
+        t.Fatalf("unexpected crypto %+v", crypto)
+    }
+    if out := Write(*description, nil); out != sdp {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+}
+
+func TestWriteEncryptionKey(t *testing.T) {
+    sdp := "v=0\r\n" +
+        "o=- 20518 0 IN IP4 203.0.113.1\r\n" +
+        "s=-\r\n" +
+        "t=0 0\r\n" +
+        "k=clear:secret\r\n" +
+        "a=recvonly\r\n" +
+        "m=audio 54400 RTP/AVP 0\r\n" +
+        "b=AS:64\r\n" +
+        "k=uri:https://keys.example.com/audio\r\n" +
+        "a=rtpmap:0 PCMU/8000\r\n" +
+        "m=video 55400 RTP/AVP 31\r\n" +
+        "k=prompt\r\n"
+
+    description, err := ParseWithOptions(sdp, ParseOptions{Strict: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if key := description.EncryptionKey; key.Method != "clear" || *key.Value != "secret" {
+        t.Fatalf("unexpected session key %+v", key)
+    }
+    if key := description.Media[0].EncryptionKey; key.Method != "uri" || *key.Value != "https://keys.example.com/audio" {
+        t.Fatalf("unexpected media key %+v", key)
+    }
+    if key := description.Media[1].EncryptionKey; key.Method != "prompt" || key.Value != nil {
+        t.Fatalf("unexpected prompt key %+v", key)
+    }
+
+    description.Media[0].EncryptionKey = nil
+    description.Media[1].EncryptionKey = &EncryptionKey{Method: "base64", Value: pointer.String("c2VjcmV0")}
+    want := strings.Replace(strings.Replace(sdp, "k=prompt", "k=base64:c2VjcmV0", 1), "k=uri:https://keys.example.com/audio\r\n", "", 1)
+    if out := Write(*description, nil); out != want {
+        t.Fatalf("unexpected output:\n%s", out)
+    }
+}
+
+func BenchmarkWrite(b *testing.B) {
+    description, err := Parse(benchmarkSDP)
+    if err != nil {
+        b.Fatal(err)
+    }
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        Write(*description, nil)
+    }
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+    return 0, errors.New("connection reset")
+}
+
+func TestWriteTo(t *testing.T) {
+    description, err := Parse(benchmarkSDP)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var buf bytes.Buffer
+    n, err := WriteTo(&buf, *description, nil)
+    if err != nil || n != int64(buf.Len()) || buf.String() != Write(*description, nil) {
+        t.Fatalf("unexpected WriteTo result %d, %v", n, err)
+    }
+    if _, err := WriteTo(failingWriter{}, *description, nil); err == nil || err.Error() != "connection reset" {
+        t.Fatalf("expected the writer error, got %v", err)
+    }
+}
+
+func TestWriteErrors(t *testing.T) {
+    description, err := Parse(benchmarkSDP)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    description.Media[0].Candidates[1] = nil
+    out, err := WriteWithError(*description, nil)
+    var writeErr *WriteError
+    if out != "" || !errors.As(err, &writeErr) || writeErr.Field != "candidates" || !errors.Is(err, ErrUnsupportedValue) {
+        t.Fatalf("expected a WriteError for candidates, got %q, %v", out, err)
+    }
+    if Write(*description, nil) != "" {
+        t.Fatal("expected Write to return an empty string")
+    }
+
+    description.Media[0].Candidates = nil
+    description.Media[1].ImageAttrs = []*ImageAttr{{PT: struct{}{}, Dir1: "send", Attrs1: "*"}}
+    _, err = WriteWithError(*description, nil)
+    if !errors.As(err, &writeErr) || writeErr.Type != "a" || writeErr.Rule != "imageattrs" || writeErr.Field != "pt" {
+        t.Fatalf("expected a WriteError for imageattrs.pt, got %v", err)
+    }
+
+    description.Media[1].ImageAttrs = nil
+    description.Media = append(description.Media, nil)
+    if _, err = WriteWithError(*description, nil); !errors.As(err, &writeErr) || writeErr.Field != "media" {
+        t.Fatalf("expected a WriteError for media, got %v", err)
+    }
+}
+
+func TestWriteRejectsInjection(t *testing.T) {
+    description, err := Parse(benchmarkSDP)
+    if err != nil {
+        t.Fatal(err)
+    }
+    description.Name = pointer.String("talk\r\na=candidate:1 1 udp 1 198.51.100.66 9 typ host")
+
+    _, err = WriteWithError(*description, nil)
+    var writeErr *WriteError
+    if !errors.As(err, &writeErr) || writeErr.Type != "s" || writeErr.Rule != "name" || !errors.Is(err, ErrControlCharacter) {
+        t.Fatalf("expected a WriteError for the session name, got %v", err)
+    }
+
+    out, err := WriteWithError(*description, &WriteOptions{Sanitize: SanitizeStrip})
+    if err != nil || !strings.Contains(out, "s=talka=candidate:1 1 udp 1 198.51.100.66 9 typ host\r\n") || strings.Count(out, "a=candidate") != 4 {
+        t.Fatalf("unexpected sanitized output %q, %v", out, err)
+    }
+
+    description.Name = pointer.String("-")
+    description.Media[0].Invalid = []*Invalid{{Value: "x\nc=IN IP4 198.51.100.66"}}
+    if _, err = WriteWithError(*description, nil); !errors.As(err, &writeErr) || writeErr.Rule != "invalid" || writeErr.Field != "value" {
+        t.Fatalf("expected a WriteError for the invalid attribute, got %v", err)
+    }
+
+    description.Media[0].Invalid = nil
+    description.Unknown = []*UnknownLine{{Type: "y\r\nc", Value: "x"}}
+    if _, err = WriteWithError(*description, nil); !errors.As(err, &writeErr) || writeErr.Field != "type" {
+        t.Fatalf("expected a WriteError for the unknown line type, got %v", err)
+    }
+}